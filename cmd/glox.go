@@ -2,10 +2,16 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"glox/internal"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 )
 
 type ErrorType int
@@ -16,64 +22,368 @@ const (
 	HadRuntimeError
 )
 
-func run(code []byte) ErrorType {
-	reporter := internal.StateErrorReporter{}
-	frontend := internal.NewFrontend(code, &reporter)
-	expr := frontend.Parse()
-	interpreter := internal.NewInterpreter(&reporter)
+// Command-line flags.
+var (
+	printAst    = flag.Bool("ast", false, "print the parsed AST instead of interpreting the code")
+	printTokens = flag.Bool("tokens", false, "print the scanned tokens instead of interpreting the code")
+	warnUnused  = flag.Bool("warn-unused", false, "warn about local variables that are never read")
+	inline      = flag.String("e", "", "run the given code instead of a script")
+	printTimes  = flag.Bool("time", false, "print how long each phase of running the code took to standard error")
+	useVM       = flag.Bool("vm", false, "run the code on the bytecode VM, which only supports expressions and print statements so far")
+	noHistory   = flag.Bool("no-history", false, "don't load or append the lines entered in the REPL to "+historyFile)
+	decimals    = flag.Int("decimals", internal.ShortestDecimals, "print floating point numbers with this many decimals; by default as few as needed to read them back exactly")
+)
 
-	if reporter.HadError {
-		return HadGeneralError
+// historyFile is the file in the home directory that lines entered in the REPL are
+// appended to, and loaded from when the REPL starts.
+const historyFile = ".glox_history"
+
+// errorCount is the number of errors found while running code.
+type errorCount struct {
+	errors        int // All errors, including runtime errors
+	runtimeErrors int
+}
+
+// String summarizes the count, e.g. "3 errors".
+func (count errorCount) String() string {
+	if count.errors == 1 {
+		return "1 error"
+	}
+	return fmt.Sprintf("%d errors", count.errors)
+}
+
+// session runs code against a single interpreter, so that the global environment is kept
+// between runs, e.g. between lines entered in the REPL.
+type session struct {
+	reporter    *internal.StateErrorReporter
+	interpreter internal.Interpreter
+	vm          internal.VM
+	history     []string // The lines entered in the REPL, oldest first, also of earlier sessions
+}
+
+func newSession(out io.Writer) *session {
+	reporter := internal.NewStateErrorReporter(nil)
+	session := &session{
+		reporter:    reporter,
+		interpreter: internal.NewInterpreter(reporter, out),
+		vm:          internal.NewVM(reporter, out),
+	}
+	session.interpreter.Decimals = *decimals
+	session.vm.SetDecimals(*decimals)
+	return session
+}
+
+// run runs the code and returns the kind and number of errors found. In interactive mode,
+// code that is a single expression is evaluated and the result is printed.
+func (session *session) run(code []byte, interactive bool) (ErrorType, errorCount) {
+	errorType := session.execute(code, interactive)
+	return errorType, errorCount{
+		errors:        session.reporter.ErrorCount,
+		runtimeErrors: session.reporter.RuntimeErrorCount,
 	}
-	if expr != nil {
-		interpreter.Interpret(expr)
-		if reporter.HadRuntimeError {
-			return HadRuntimeError
+}
+
+func (session *session) execute(code []byte, interactive bool) ErrorType {
+	// Errors of previous runs should not affect this run.
+	session.reporter.Reset()
+	session.reporter.SetSource(code)
+
+	if *printTokens {
+		scanner := internal.NewScanner(code, session.reporter)
+		for _, token := range scanner.ScanTokens() {
+			fmt.Println(token)
+		}
+		if session.reporter.HadError {
+			return HadGeneralError
+		}
+		return HadNoError
+	}
+
+	frontend := internal.NewFrontend(code, session.reporter)
+	var resolveTime, interpretTime time.Duration
+	if *printTimes {
+		defer func() {
+			fmt.Fprintf(os.Stderr, "scan: %v\nparse: %v\nresolve: %v\ninterpret: %v\n",
+				frontend.ScanTime, frontend.ParseTime, resolveTime, interpretTime)
+		}()
+	}
+
+	if interactive && !*printAst {
+		if expr := frontend.ParseExpression(); expr != nil && *useVM {
+			return session.runOnVM([]internal.Stmt{internal.Print{Expressions: []internal.Expr{expr}}})
+		} else if expr != nil {
+			start := time.Now()
+			resolver := internal.NewResolver(&session.interpreter, session.reporter)
+			resolver.WarnUnused = *warnUnused
+			e := resolver.ResolveExpression(expr)
+			resolveTime = time.Since(start)
+			if e != nil {
+				return HadGeneralError
+			}
+			start = time.Now()
+			session.interpreter.Interpret(expr)
+			interpretTime = time.Since(start)
+			if session.reporter.HadRuntimeError {
+				return HadRuntimeError
+			}
+			return HadNoError
 		}
 	}
+
+	statements, e := frontend.ParseChecked()
+	if e != nil {
+		return HadGeneralError
+	}
+	if *printAst {
+		fmt.Println(internal.AstPrinter{}.Print(statements))
+		return HadNoError
+	}
+	if *useVM {
+		return session.runOnVM(statements)
+	}
+	start := time.Now()
+	resolver := internal.NewResolver(&session.interpreter, session.reporter)
+	resolver.WarnUnused = *warnUnused
+	e = resolver.Resolve(statements)
+	resolveTime = time.Since(start)
+	if e != nil {
+		return HadGeneralError
+	}
+	start = time.Now()
+	session.interpreter.Execute(statements)
+	interpretTime = time.Since(start)
+	if session.reporter.HadRuntimeError {
+		return HadRuntimeError
+	}
 	return HadNoError
 }
 
+// runOnVM compiles the statements to bytecode and runs them on the VM.
+func (session *session) runOnVM(statements []internal.Stmt) ErrorType {
+	chunk, e := internal.Compile(statements, session.reporter)
+	if e != nil {
+		return HadGeneralError
+	}
+	session.vm.Run(chunk)
+	if session.reporter.HadRuntimeError {
+		return HadRuntimeError
+	}
+	return HadNoError
+}
+
+// runFile runs the script at the path. The script is read from standard input if the path
+// is "-".
 func runFile(filePath string) error {
-	if code, e := ioutil.ReadFile(filePath); e != nil {
-		return e
+	var code []byte
+	var e error
+	if filePath == "-" {
+		code, e = ioutil.ReadAll(os.Stdin)
 	} else {
-		switch run(code) {
-		case HadGeneralError:
-			os.Exit(65)
-		case HadRuntimeError:
-			os.Exit(70)
-		case HadNoError:
-			return nil
-		}
+		code, e = ioutil.ReadFile(filePath)
+	}
+	if e != nil {
+		return e
 	}
+	runCode(code)
 	return nil
 }
 
-func runPrompt() error {
-	reader := bufio.NewReader(os.Stdin)
+// runCode runs the code as a whole program. If it fails, the number of errors is printed
+// and the program exits with an error code.
+func runCode(code []byte) {
+	errorType, count := newSession(os.Stdout).run(code, false)
+	if errorType != HadNoError {
+		fmt.Fprintln(os.Stderr, count)
+	}
+	switch errorType {
+	case HadGeneralError:
+		os.Exit(65)
+	case HadRuntimeError:
+		os.Exit(70)
+	}
+}
+
+// commandHelp describes the REPL commands.
+const commandHelp = `:env         list the global variables and their values
+:ast <expr>  print the parse tree of the expression
+:history     list the lines entered, also in earlier sessions
+:help        show this help
+:quit        exit the REPL
+`
+
+// command runs a REPL command, such as ":env". It reports whether the REPL should exit.
+func (session *session) command(line string, out io.Writer) bool {
+	name, argument := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, argument = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	switch name {
+	case ":quit":
+		return true
+	case ":env":
+		globals := session.interpreter.Globals()
+		names := make([]string, 0, len(globals))
+		for global := range globals {
+			names = append(names, global)
+		}
+		sort.Strings(names)
+		for _, global := range names {
+			fmt.Fprintf(out, "%s = %s\n", global, globals[global])
+		}
+	case ":ast":
+		code := []byte(argument)
+		session.reporter.Reset()
+		session.reporter.SetSource(code)
+		scanner := internal.NewScanner(code, session.reporter)
+		parser := internal.NewParser(scanner.ScanTokens(), session.reporter)
+		if expr, e := parser.ParseExpression(); e == nil && !session.reporter.HadError {
+			fmt.Fprintln(out, internal.AstPrinter{}.PrintExpr(expr))
+		}
+	case ":history":
+		for i, entry := range session.history {
+			fmt.Fprintf(out, "%5d  %s\n", i+1, entry)
+		}
+	case ":help":
+		fmt.Fprint(out, commandHelp)
+	default:
+		fmt.Fprintf(out, "Unknown command '%s'. Enter :help for a list of commands.\n", name)
+	}
+	return false
+}
+
+// openHistory opens the history file for reading and appending, creating it if needed.
+func openHistory() (*os.File, error) {
+	home, e := os.UserHomeDir()
+	if e != nil {
+		return nil, e
+	}
+	return os.OpenFile(filepath.Join(home, historyFile), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+}
+
+// readHistory returns the non-empty lines of the history.
+func readHistory(history io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(history)
+	for scanner.Scan() {
+		if line := scanner.Text(); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// runPrompt runs the lines read from in. Unfinished code, such as an unclosed block, is
+// continued on the next lines until it is complete or an empty line is entered. Lines
+// starting with a colon are REPL commands, see commandHelp. Unless history is nil, the
+// lines in it are loaded first, and non-empty lines are appended to it.
+func runPrompt(in io.Reader, out io.Writer, history io.ReadWriter) error {
+	reader := bufio.NewReader(in)
+	session := newSession(out)
+	if history != nil {
+		lines, err := readHistory(history)
+		if err != nil {
+			// Losing the history isn't worth ending the session over.
+			fmt.Fprintf(os.Stderr, "Can't read the history file, history is disabled: %v\n", err)
+			history = nil
+		}
+		session.history = lines
+	}
+	// The input native function must read from the same buffer as the prompt, or lines
+	// read ahead by one would be lost to the other.
+	session.interpreter.SetInput(reader)
+	var code []byte
 	for {
-		fmt.Print("> ")
-		if line, _, err := reader.ReadLine(); err != nil {
-			return err
+		if len(code) == 0 {
+			fmt.Fprint(out, "> ")
 		} else {
-			_ = run(line)
+			fmt.Fprint(out, "... ")
 		}
+
+		line, _, err := reader.ReadLine()
+		if err == io.EOF {
+			// Ctrl-D ends the session. Move to a new line so the shell prompt isn't
+			// printed after ours.
+			fmt.Fprintln(out)
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if len(line) > 0 {
+			session.history = append(session.history, string(line))
+		}
+		if history != nil && len(line) > 0 {
+			if _, err := fmt.Fprintf(history, "%s\n", line); err != nil {
+				// Losing the history isn't worth ending the session over.
+				fmt.Fprintf(os.Stderr, "Can't write to the history file, history is disabled: %v\n", err)
+				history = nil
+			}
+		}
+
+		if trimmed := strings.TrimSpace(string(line)); len(code) == 0 && strings.HasPrefix(trimmed, ":") {
+			if session.command(trimmed, out) {
+				return nil
+			}
+			continue
+		}
+
+		code = append(code, line...)
+		code = append(code, '\n')
+		frontend := internal.NewFrontend(code, session.reporter)
+		if len(line) > 0 && frontend.IsIncomplete() {
+			continue
+		}
+		_, _ = session.run(code, true)
+		code = nil
 	}
 }
 
 func main() {
-	argv := os.Args[1:]
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: glox [flags] [script | -]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	argv := flag.Args()
+
+	if *printAst && *printTokens {
+		fmt.Fprintln(flag.CommandLine.Output(), "The -ast and -tokens flags cannot be combined.")
+		flag.Usage()
+		os.Exit(64)
+	}
+
+	if *inline != "" && len(argv) > 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), "The -e flag cannot be combined with a script.")
+		flag.Usage()
+		os.Exit(64)
+	}
 
 	if argc := len(argv); argc > 1 {
-		fmt.Println("Usage: glox [script]")
+		flag.Usage()
 		os.Exit(64)
+	} else if *inline != "" {
+		runCode([]byte(*inline))
 	} else if argc == 1 {
 		if e := runFile(argv[0]); e != nil {
 			os.Exit(1)
 		}
+	} else if !internal.IsTerminal(os.Stdin) {
+		// The script is piped in, e.g. `echo 'print 1;' | glox`.
+		if e := runFile("-"); e != nil {
+			os.Exit(1)
+		}
 	} else {
-		if e := runPrompt(); e != nil {
+		var history io.ReadWriter
+		if !*noHistory {
+			if file, e := openHistory(); e != nil {
+				fmt.Fprintf(os.Stderr, "Can't open the history file, history is disabled: %v\n", e)
+			} else {
+				defer file.Close()
+				history = file
+			}
+		}
+		if e := runPrompt(os.Stdin, os.Stdout, history); e != nil {
 			fmt.Println(e)
 			os.Exit(1)
 		}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPromptKeepsEnvironment(t *testing.T) {
+	in := strings.NewReader("var x = 1;\nx + 1\n")
+	out := bytes.Buffer{}
+	if err := runPrompt(in, &out, nil); err != nil {
+		t.Fatalf("expected the end of input to end the prompt without error, got %v", err)
+	}
+
+	if printed := out.String(); !strings.Contains(printed, "> 2\n") {
+		t.Errorf("expected x + 1 to print 2, got %q", printed)
+	}
+}
+
+// Lines of the REPL start at the same position, which must not mix up the variables that
+// functions declared on earlier lines resolved.
+func TestPromptKeepsResolvedVariables(t *testing.T) {
+	in := strings.NewReader("fun f() { var a = 1; return a; }\nfun g() { var b = 2; return a; }\nf()\n")
+	out := bytes.Buffer{}
+	_ = runPrompt(in, &out, nil)
+
+	if printed := out.String(); printed != "> > > 1\n> \n" {
+		t.Errorf("unexpected output %q", printed)
+	}
+}
+
+func TestPromptContinuesUnfinishedCode(t *testing.T) {
+	in := strings.NewReader("fun add(a, b) {\n  return a +\n b;\n}\nadd(1,\n2)\n")
+	out := bytes.Buffer{}
+	_ = runPrompt(in, &out, nil)
+
+	if printed := out.String(); printed != "> ... ... ... > ... 3\n> \n" {
+		t.Errorf("unexpected output %q", printed)
+	}
+}
+
+func TestRunCountsErrors(t *testing.T) {
+	session := newSession(&bytes.Buffer{})
+	errorType, count := session.run([]byte("print 1 +;\nvar = 2;\nprint (3;\n"), false)
+	if errorType != HadGeneralError {
+		t.Errorf("expected a general error, got %v", errorType)
+	}
+	if count.errors != 3 || count.runtimeErrors != 0 || count.String() != "3 errors" {
+		t.Errorf("expected 3 errors, got %+v", count)
+	}
+
+	errorType, count = session.run([]byte("print -\"a\";"), false)
+	if errorType != HadRuntimeError {
+		t.Errorf("expected a runtime error, got %v", errorType)
+	}
+	if count.errors != 1 || count.runtimeErrors != 1 || count.String() != "1 error" {
+		t.Errorf("expected 1 runtime error, got %+v", count)
+	}
+}
+
+func TestRunPrintsFinalExpression(t *testing.T) {
+	out := bytes.Buffer{}
+	session := newSession(&out)
+	if errorType, count := session.run([]byte("1 + 2"), false); errorType != HadNoError {
+		t.Fatalf("unexpected errors: %v", count)
+	}
+	if printed := out.String(); printed != "3\n" {
+		t.Errorf("expected the final expression to be printed, got %q", printed)
+	}
+}
+
+func TestPromptCommands(t *testing.T) {
+	in := strings.NewReader("var b = \"x\";\nvar a = [1, 2];\n:env\n:ast 1 + 2 * -x\n:help\n:what\n:quit\nprint 1;\n")
+	out := bytes.Buffer{}
+	if err := runPrompt(in, &out, nil); err != nil {
+		t.Fatalf("expected :quit to end the prompt without error, got %v", err)
+	}
+
+	expected := "> > > a = [1, 2]\nb = x\n" +
+		"> (+ 1 (* 2 (- x)))\n" +
+		"> " + commandHelp +
+		"> Unknown command ':what'. Enter :help for a list of commands.\n" +
+		"> "
+	if printed := out.String(); printed != expected {
+		t.Errorf("expected output %q, got %q", expected, printed)
+	}
+}
+
+func TestPromptAppendsHistory(t *testing.T) {
+	file, err := ioutil.TempFile("", historyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := file.Name()
+	defer os.Remove(path)
+	_, err = file.WriteString("print 0;\n")
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+
+	in := strings.NewReader("var a = 1;\n\n:env\nprint a;\n:history\n")
+	out := bytes.Buffer{}
+	if err := runPrompt(in, &out, history); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "print 0;\nvar a = 1;\n:env\nprint a;\n:history\n"; string(content) != expected {
+		t.Errorf("expected history %q, got %q", expected, content)
+	}
+
+	// The lines of earlier sessions are loaded when the prompt starts.
+	listed := "    1  print 0;\n    2  var a = 1;\n    3  :env\n    4  print a;\n    5  :history\n"
+	if printed := out.String(); !strings.HasSuffix(printed, listed+"> \n") {
+		t.Errorf("expected :history to list %q, got %q", listed, printed)
+	}
+}
+
+func TestPromptOnVM(t *testing.T) {
+	*useVM = true
+	defer func() { *useVM = false }()
+
+	in := strings.NewReader("1 + 2\nprint \"a\" * 2;\nvar a = 1;\n")
+	out := bytes.Buffer{}
+	_ = runPrompt(in, &out, nil)
+
+	if printed := out.String(); printed != "> 3\n> aa\n> > \n" {
+		t.Errorf("unexpected output %q", printed)
+	}
+}
@@ -10,6 +10,20 @@ type ExprVisitor interface {
 	VisitLiteral(Literal) (error, interface{})
 	VisitUnary(Unary) (error, interface{})
 	VisitTernary(Ternary) (error, interface{})
+	VisitVariable(Variable) (error, interface{})
+	VisitAssign(Assign) (error, interface{})
+	VisitLogical(Logical) (error, interface{})
+	VisitCall(Call) (error, interface{})
+	VisitList(List) (error, interface{})
+	VisitIndex(Index) (error, interface{})
+	VisitSetIndex(SetIndex) (error, interface{})
+	VisitMap(Map) (error, interface{})
+	VisitGet(Get) (error, interface{})
+	VisitSet(Set) (error, interface{})
+	VisitThis(This) (error, interface{})
+	VisitSuper(Super) (error, interface{})
+	VisitLambda(Lambda) (error, interface{})
+	VisitInterpolation(Interpolation) (error, interface{})
 }
 
 type Expr interface {
@@ -52,6 +66,7 @@ func (e Unary) Visit(v ExprVisitor) (error, interface{}) {
 
 type Ternary struct {
 	Cond        Expr
+	Question    Token
 	TrueBranch  Expr
 	FalseBranch Expr
 }
@@ -60,16 +75,161 @@ func (e Ternary) Visit(v ExprVisitor) (error, interface{}) {
 	return v.VisitTernary(e)
 }
 
+type Variable struct {
+	Name       Token
+	Resolution *Resolution
+}
+
+func (e Variable) Visit(v ExprVisitor) (error, interface{}) {
+	return v.VisitVariable(e)
+}
+
+type Assign struct {
+	Name       Token
+	Value      Expr
+	Resolution *Resolution
+}
+
+func (e Assign) Visit(v ExprVisitor) (error, interface{}) {
+	return v.VisitAssign(e)
+}
+
+type Logical struct {
+	Left     Expr
+	Operator Token
+	Right    Expr
+}
+
+func (e Logical) Visit(v ExprVisitor) (error, interface{}) {
+	return v.VisitLogical(e)
+}
+
+type Call struct {
+	Callee    Expr
+	Paren     Token
+	Arguments []Expr
+}
+
+func (e Call) Visit(v ExprVisitor) (error, interface{}) {
+	return v.VisitCall(e)
+}
+
+type List struct {
+	Bracket  Token
+	Elements []Expr
+}
+
+func (e List) Visit(v ExprVisitor) (error, interface{}) {
+	return v.VisitList(e)
+}
+
+type Index struct {
+	Object  Expr
+	Bracket Token
+	Index   Expr
+}
+
+func (e Index) Visit(v ExprVisitor) (error, interface{}) {
+	return v.VisitIndex(e)
+}
+
+type SetIndex struct {
+	Object  Expr
+	Bracket Token
+	Index   Expr
+	Value   Expr
+}
+
+func (e SetIndex) Visit(v ExprVisitor) (error, interface{}) {
+	return v.VisitSetIndex(e)
+}
+
+type Map struct {
+	Brace  Token
+	Keys   []Expr
+	Values []Expr
+}
+
+func (e Map) Visit(v ExprVisitor) (error, interface{}) {
+	return v.VisitMap(e)
+}
+
+type Get struct {
+	Object Expr
+	Name   Token
+}
+
+func (e Get) Visit(v ExprVisitor) (error, interface{}) {
+	return v.VisitGet(e)
+}
+
+type Set struct {
+	Object Expr
+	Name   Token
+	Value  Expr
+}
+
+func (e Set) Visit(v ExprVisitor) (error, interface{}) {
+	return v.VisitSet(e)
+}
+
+type This struct {
+	Keyword    Token
+	Resolution *Resolution
+}
+
+func (e This) Visit(v ExprVisitor) (error, interface{}) {
+	return v.VisitThis(e)
+}
+
+type Super struct {
+	Keyword    Token
+	Method     Token
+	Resolution *Resolution
+}
+
+func (e Super) Visit(v ExprVisitor) (error, interface{}) {
+	return v.VisitSuper(e)
+}
+
+type Lambda struct {
+	Declaration Function
+}
+
+func (e Lambda) Visit(v ExprVisitor) (error, interface{}) {
+	return v.VisitLambda(e)
+}
+
+type Interpolation struct {
+	Start Token
+	Parts []Expr
+}
+
+func (e Interpolation) Visit(v ExprVisitor) (error, interface{}) {
+	return v.VisitInterpolation(e)
+}
+
 type StmtVisitor interface {
 	VisitExpression(Expression) (error, interface{})
 	VisitPrint(Print) (error, interface{})
+	VisitVar(Var) (error, interface{})
+	VisitBlock(Block) (error, interface{})
+	VisitIf(If) (error, interface{})
+	VisitWhile(While) (error, interface{})
+	VisitDoWhile(DoWhile) (error, interface{})
+	VisitFunction(Function) (error, interface{})
+	VisitReturn(Return) (error, interface{})
+	VisitBreak(Break) (error, interface{})
+	VisitContinue(Continue) (error, interface{})
+	VisitSwitch(Switch) (error, interface{})
+	VisitClass(Class) (error, interface{})
 }
 
 type Stmt interface {
 	Visit(v StmtVisitor) (error, interface{})
 }
 type Expression struct {
-	Expr *Expression
+	Expression Expr
 }
 
 func (e Expression) Visit(v StmtVisitor) (error, interface{}) {
@@ -77,9 +237,115 @@ func (e Expression) Visit(v StmtVisitor) (error, interface{}) {
 }
 
 type Print struct {
-	Expr Expression
+	Expressions []Expr
 }
 
 func (e Print) Visit(v StmtVisitor) (error, interface{}) {
 	return v.VisitPrint(e)
 }
+
+type Var struct {
+	Name        Token
+	Initializer Expr
+}
+
+func (e Var) Visit(v StmtVisitor) (error, interface{}) {
+	return v.VisitVar(e)
+}
+
+type Block struct {
+	Statements []Stmt
+}
+
+func (e Block) Visit(v StmtVisitor) (error, interface{}) {
+	return v.VisitBlock(e)
+}
+
+type If struct {
+	Keyword    Token
+	Condition  Expr
+	ThenBranch Stmt
+	ElseBranch Stmt
+}
+
+func (e If) Visit(v StmtVisitor) (error, interface{}) {
+	return v.VisitIf(e)
+}
+
+type While struct {
+	Keyword   Token
+	Condition Expr
+	Body      Stmt
+	Increment Expr
+}
+
+func (e While) Visit(v StmtVisitor) (error, interface{}) {
+	return v.VisitWhile(e)
+}
+
+type DoWhile struct {
+	Keyword   Token
+	Body      Stmt
+	Condition Expr
+}
+
+func (e DoWhile) Visit(v StmtVisitor) (error, interface{}) {
+	return v.VisitDoWhile(e)
+}
+
+type Function struct {
+	Name   Token
+	Params []Token
+	Body   []Stmt
+}
+
+func (e Function) Visit(v StmtVisitor) (error, interface{}) {
+	return v.VisitFunction(e)
+}
+
+type Return struct {
+	Keyword Token
+	Value   Expr
+}
+
+func (e Return) Visit(v StmtVisitor) (error, interface{}) {
+	return v.VisitReturn(e)
+}
+
+type Break struct {
+	Keyword Token
+}
+
+func (e Break) Visit(v StmtVisitor) (error, interface{}) {
+	return v.VisitBreak(e)
+}
+
+type Continue struct {
+	Keyword Token
+}
+
+func (e Continue) Visit(v StmtVisitor) (error, interface{}) {
+	return v.VisitContinue(e)
+}
+
+type Switch struct {
+	Keyword Token
+	Subject Expr
+	Cases   []Expr
+	Bodies  []Stmt
+	Default Stmt
+}
+
+func (e Switch) Visit(v StmtVisitor) (error, interface{}) {
+	return v.VisitSwitch(e)
+}
+
+type Class struct {
+	Name       Token
+	Superclass Expr
+	Methods    []Function
+}
+
+func (e Class) Visit(v StmtVisitor) (error, interface{}) {
+	return v.VisitClass(e)
+}
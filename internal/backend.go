@@ -1,7 +1,12 @@
 package internal
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
 )
 
 type RuntimeError struct {
@@ -14,34 +19,143 @@ func (r RuntimeError) Error() string {
 }
 
 type Interpreter struct {
-	reporter ErrorReporter
+	reporter    ErrorReporter
+	globals     *Environment  // The outermost environment
+	environment *Environment  // The environment of the code being executed
+	out         io.Writer     // Where printed values are written to
+	in          *bufio.Reader // Where the input native function reads lines from
+	// The number of decimals that printed floating point numbers have, or ShortestDecimals
+	// to print as few as needed to read the number back exactly.
+	Decimals int
+	// The number of calls that haven't returned yet, see maxCallDepth
+	callDepth int
 }
 
-func NewInterpreter(reporter ErrorReporter) Interpreter {
+// NewInterpreter creates an interpreter that prints to out. If out is nil then the
+// interpreter prints to standard output.
+func NewInterpreter(reporter ErrorReporter, out io.Writer) Interpreter {
+	if out == nil {
+		out = os.Stdout
+	}
+
+	globals := NewEnvironment(nil)
+	defineNatives(globals)
 	return Interpreter{
-		reporter: reporter,
+		reporter:    reporter,
+		globals:     globals,
+		environment: globals,
+		out:         out,
+		in:          bufio.NewReader(os.Stdin),
+		Decimals:    ShortestDecimals,
+	}
+}
+
+// stringify returns the value as printed by a print statement.
+func (interpreter *Interpreter) stringify(value interface{}) string {
+	return format(value, interpreter.Decimals)
+}
+
+// SetInput makes the interpreter read input, e.g. by the input native function, from in
+// rather than standard input.
+func (interpreter *Interpreter) SetInput(in io.Reader) {
+	interpreter.in = bufio.NewReader(in)
+}
+
+// Globals returns the global variables defined by Lox code, mapped to their values as
+// printed by a print statement. Native functions are left out.
+func (interpreter *Interpreter) Globals() map[string]string {
+	globals := make(map[string]string)
+	for name, value := range interpreter.globals.values {
+		if !isNative(value) {
+			globals[name] = interpreter.stringify(value)
+		}
+	}
+	return globals
+}
+
+// lookUpVariable looks up the variable where the Resolver found it to be declared.
+func (interpreter *Interpreter) lookUpVariable(name Token, resolution *Resolution) (error, interface{}) {
+	if resolution.isLocal {
+		return interpreter.environment.GetAt(resolution.depth, name)
+	}
+	return interpreter.globals.Get(name)
+}
+
+// Execute executes the statements in order. Execution stops at the first runtime error,
+// which is reported to the error reporter.
+func (interpreter *Interpreter) Execute(statements []Stmt) {
+	for _, stmt := range statements {
+		if e, _ := interpreter.execute(stmt); e != nil {
+			switch err := e.(type) {
+			case RuntimeError:
+				interpreter.reporter.RuntimeError(err)
+				return
+			default:
+				panic(err)
+			}
+		}
 	}
 }
 
-// Interpret interprets the expression and returns a regular Golang value, e.g. nil, string, float64, etc.
-func (interpreter Interpreter) Interpret(expr Expr) {
-	if e, r := interpreter.visit(expr); e != nil {
+// Interpret evaluates the expression and prints the resulting value. A runtime error is
+// reported to the error reporter instead.
+func (interpreter *Interpreter) Interpret(expr Expr) {
+	e, value := interpreter.visit(expr)
+	if e == nil {
+		_, e = fmt.Fprintln(interpreter.out, interpreter.stringify(value))
+	}
+	if e != nil {
 		switch err := e.(type) {
 		case RuntimeError:
 			interpreter.reporter.RuntimeError(err)
 		default:
 			panic(err)
 		}
-	} else {
-		fmt.Println(stringify(r))
 	}
 }
 
-func (interpreter Interpreter) visit(expr Expr) (error, interface{}) {
+func (interpreter *Interpreter) execute(stmt Stmt) (error, interface{}) {
+	return stmt.Visit(interpreter)
+}
+
+// visit evaluates the expression and returns a regular Golang value, e.g. nil, string, int64, float64, etc.
+func (interpreter *Interpreter) visit(expr Expr) (error, interface{}) {
 	return expr.Visit(interpreter)
 }
 
-func (interpreter Interpreter) VisitBinary(binary Binary) (error, interface{}) {
+func (interpreter *Interpreter) VisitExpression(stmt Expression) (error, interface{}) {
+	e, _ := interpreter.visit(stmt.Expression)
+	return e, nil
+}
+
+// VisitPrint prints the values on one line, separated by spaces.
+func (interpreter *Interpreter) VisitPrint(stmt Print) (error, interface{}) {
+	values := make([]string, len(stmt.Expressions))
+	for i, expr := range stmt.Expressions {
+		e, value := interpreter.visit(expr)
+		if e != nil {
+			return e, nil
+		}
+		values[i] = interpreter.stringify(value)
+	}
+	_, e := fmt.Fprintln(interpreter.out, strings.Join(values, " "))
+	return e, nil
+}
+
+func (interpreter *Interpreter) VisitVar(stmt Var) (error, interface{}) {
+	var value interface{}
+	if stmt.Initializer != nil {
+		var e error
+		if e, value = interpreter.visit(stmt.Initializer); e != nil {
+			return e, nil
+		}
+	}
+
+	interpreter.environment.Define(stmt.Name.Lexeme, value)
+	return nil, nil
+}
+
+func (interpreter *Interpreter) VisitBinary(binary Binary) (error, interface{}) {
 	// Important: left to right evaluation.
 	e, left := interpreter.visit(binary.Left)
 	if e != nil {
@@ -51,80 +165,150 @@ func (interpreter Interpreter) VisitBinary(binary Binary) (error, interface{}) {
 	if e != nil {
 		return e, nil
 	}
+	return interpreter.binary(binary.Operator, left, right)
+}
 
-	switch binary.Operator.Type {
+// binary applies the binary operator to the values of its operands.
+func (interpreter *Interpreter) binary(operator Token, left interface{}, right interface{}) (error, interface{}) {
+	switch operator.Type {
+	case TokenComma:
+		// Both operands are evaluated, the result is the right one.
+		return nil, right
 	case TokenMinus:
-		if e, leftV := interpreter.assertNumber(binary.Operator, left); e != nil {
+		if leftV, rightV, isInteger := integers(left, right); isInteger && !subtractionOverflows(leftV, rightV) {
+			return nil, leftV - rightV
+		} else if e, leftV := interpreter.assertNumber(operator, left); e != nil {
 			return e, nil
-		} else if e, rightV := interpreter.assertNumber(binary.Operator, right); e != nil {
+		} else if e, rightV := interpreter.assertNumber(operator, right); e != nil {
 			return e, nil
 		} else {
 			return nil, leftV - rightV
 		}
 	case TokenSlash:
-		if e, leftV := interpreter.assertNumber(binary.Operator, left); e != nil {
+		// Division is always floating point, even for two integers.
+		if e, leftV := interpreter.assertNumber(operator, left); e != nil {
 			return e, nil
-		} else if e, rightV := interpreter.assertNumber(binary.Operator, right); e != nil {
+		} else if e, rightV := interpreter.assertNumber(operator, right); e != nil {
 			return e, nil
+		} else if rightV == 0 {
+			return RuntimeError{
+				Token: operator,
+				Msg:   "Division by zero.",
+			}, nil
+		} else {
+			return nil, leftV / rightV
+		}
+	case TokenDiv:
+		// Integer division truncates toward zero, e.g. -7 div 2 is -3.
+		if e, leftV := interpreter.assertInteger(operator, left); e != nil {
+			return e, nil
+		} else if e, rightV := interpreter.assertInteger(operator, right); e != nil {
+			return e, nil
+		} else if rightV == 0 {
+			return RuntimeError{
+				Token: operator,
+				Msg:   "Division by zero.",
+			}, nil
 		} else {
 			return nil, leftV / rightV
 		}
 	case TokenStar:
-		if e, leftV := interpreter.assertNumber(binary.Operator, left); e != nil {
+		// A string multiplied by a count is repeated, e.g. "ab" * 2 is "abab".
+		if str, isString := left.(string); isString {
+			return interpreter.repeat(operator, str, right)
+		} else if str, isString := right.(string); isString {
+			return interpreter.repeat(operator, str, left)
+		}
+
+		if leftV, rightV, isInteger := integers(left, right); isInteger && !multiplicationOverflows(leftV, rightV) {
+			return nil, leftV * rightV
+		} else if e, leftV := interpreter.assertNumber(operator, left); e != nil {
 			return e, nil
-		} else if e, rightV := interpreter.assertNumber(binary.Operator, right); e != nil {
+		} else if e, rightV := interpreter.assertNumber(operator, right); e != nil {
 			return e, nil
 		} else {
 			return nil, leftV * rightV
 		}
+	case TokenStarStar:
+		// Integers to a non-negative power stay integers, unless the result doesn't fit.
+		if leftV, rightV, isInteger := integers(left, right); isInteger && rightV >= 0 {
+			if power, fits := integerPower(leftV, rightV); fits {
+				return nil, power
+			}
+		}
+		if e, leftV := interpreter.assertNumber(operator, left); e != nil {
+			return e, nil
+		} else if e, rightV := interpreter.assertNumber(operator, right); e != nil {
+			return e, nil
+		} else if result := math.Pow(leftV, rightV); math.IsNaN(result) {
+			// E.g. a negative base with a fractional exponent. Note that 0 ** 0 is 1.
+			return RuntimeError{
+				Token: operator,
+				Msg:   "Result of exponentiation is not a real number.",
+			}, nil
+		} else {
+			return nil, result
+		}
 	case TokenPlus:
+		if leftV, rightV, isInteger := integers(left, right); isInteger && !additionOverflows(leftV, rightV) {
+			return nil, leftV + rightV
+		}
 		switch leftV := left.(type) {
 		case string:
-			if e, rightV := interpreter.assertString(right); e != nil {
+			if e, rightV := interpreter.assertString(operator, right); e != nil {
 				return e, nil
 			} else {
 				return nil, leftV + rightV
 			}
-		case float64:
-			if e, rightV := interpreter.assertNumber(binary.Operator, right); e != nil {
-
+		case float64, int64:
+			_, leftF := interpreter.assertNumber(operator, leftV)
+			if e, rightV := interpreter.assertNumber(operator, right); e != nil {
+				return e, nil
 			} else {
-				return nil, leftV + rightV
+				return nil, leftF + rightV
 			}
 		default:
 			return RuntimeError{
-				Token: binary.Operator,
+				Token: operator,
 				Msg:   fmt.Sprintf("expected two strings or two numbers but got %v + %v", left, right),
 			}, nil
 		}
 	case TokenGreaterEqual:
-		if e, leftV := interpreter.assertNumber(binary.Operator, left); e != nil {
+		if leftV, rightV, isInteger := integers(left, right); isInteger {
+			return nil, leftV >= rightV
+		} else if e, leftV := interpreter.assertNumber(operator, left); e != nil {
 			return e, nil
-		} else if e, rightV := interpreter.assertNumber(binary.Operator, right); e != nil {
+		} else if e, rightV := interpreter.assertNumber(operator, right); e != nil {
 			return e, nil
 		} else {
 			return nil, leftV >= rightV
 		}
 	case TokenGreater:
-		if e, leftV := interpreter.assertNumber(binary.Operator, left); e != nil {
+		if leftV, rightV, isInteger := integers(left, right); isInteger {
+			return nil, leftV > rightV
+		} else if e, leftV := interpreter.assertNumber(operator, left); e != nil {
 			return e, nil
-		} else if e, rightV := interpreter.assertNumber(binary.Operator, right); e != nil {
+		} else if e, rightV := interpreter.assertNumber(operator, right); e != nil {
 			return e, nil
 		} else {
 			return nil, leftV > rightV
 		}
 	case TokenLessEqual:
-		if e, leftV := interpreter.assertNumber(binary.Operator, left); e != nil {
+		if leftV, rightV, isInteger := integers(left, right); isInteger {
+			return nil, leftV <= rightV
+		} else if e, leftV := interpreter.assertNumber(operator, left); e != nil {
 			return e, nil
-		} else if e, rightV := interpreter.assertNumber(binary.Operator, right); e != nil {
+		} else if e, rightV := interpreter.assertNumber(operator, right); e != nil {
 			return e, nil
 		} else {
 			return nil, leftV <= rightV
 		}
 	case TokenLess:
-		if e, leftV := interpreter.assertNumber(binary.Operator, left); e != nil {
+		if leftV, rightV, isInteger := integers(left, right); isInteger {
+			return nil, leftV < rightV
+		} else if e, leftV := interpreter.assertNumber(operator, left); e != nil {
 			return e, nil
-		} else if e, rightV := interpreter.assertNumber(binary.Operator, right); e != nil {
+		} else if e, rightV := interpreter.assertNumber(operator, right); e != nil {
 			return e, nil
 		} else {
 			return nil, leftV < rightV
@@ -133,55 +317,337 @@ func (interpreter Interpreter) VisitBinary(binary Binary) (error, interface{}) {
 		return nil, !interpreter.isEqual(left, right)
 	case TokenEqualEqual:
 		return nil, interpreter.isEqual(left, right)
+	case TokenAmpersand, TokenPipe, TokenCaret:
+		if e, leftV := interpreter.assertInteger(operator, left); e != nil {
+			return e, nil
+		} else if e, rightV := interpreter.assertInteger(operator, right); e != nil {
+			return e, nil
+		} else {
+			switch operator.Type {
+			case TokenAmpersand:
+				return nil, leftV & rightV
+			case TokenPipe:
+				return nil, leftV | rightV
+			default:
+				return nil, leftV ^ rightV
+			}
+		}
 	}
 
 	return RuntimeError{
-		Token: binary.Operator,
+		Token: operator,
 		Msg:   "unknown binary operation",
 	}, nil
 }
 
-func (interpreter Interpreter) VisitGrouping(grouping Grouping) (error, interface{}) {
+func (interpreter *Interpreter) VisitGrouping(grouping Grouping) (error, interface{}) {
 	return interpreter.visit(grouping.Expression)
 }
 
-func (interpreter Interpreter) VisitLiteral(literal Literal) (error, interface{}) {
-	switch v := literal.Value.(type) {
-	case Number:
-		return nil, v.V
-	case String:
-		return nil, v.V
-	case Boolean:
-		return nil, v.V
-	default:
-		return nil, v
-	}
+func (interpreter *Interpreter) VisitLiteral(literal Literal) (error, interface{}) {
+	return nil, unwrap(literal.Value)
 }
 
-func (interpreter Interpreter) VisitUnary(unary Unary) (error, interface{}) {
-	e, right := interpreter.visit(unary)
+func (interpreter *Interpreter) VisitUnary(unary Unary) (error, interface{}) {
+	e, right := interpreter.visit(unary.Right)
 	if e != nil {
 		return e, nil
 	}
+	return interpreter.unary(unary.Operator, right)
+}
 
-	switch unary.Operator.Type {
+// unary applies the unary operator to the value of its operand.
+func (interpreter *Interpreter) unary(operator Token, right interface{}) (error, interface{}) {
+	switch operator.Type {
 	case TokenMinus:
-		if e, v := interpreter.assertNumber(unary.Operator, right); e != nil {
+		if v, isInteger := right.(int64); isInteger && v != math.MinInt64 {
+			return nil, -v
+		} else if e, v := interpreter.assertNumber(operator, right); e != nil {
 			return e, nil
 		} else {
 			return nil, -v
 		}
 	case TokenBang:
 		return nil, !interpreter.isTruthy(right)
+	case TokenTilde:
+		if e, v := interpreter.assertInteger(operator, right); e != nil {
+			return e, nil
+		} else {
+			return nil, ^v
+		}
 	}
 
 	return RuntimeError{
-		Token: unary.Operator,
+		Token: operator,
 		Msg:   "unexpected unary operator",
 	}, nil
 }
 
-func (interpreter Interpreter) VisitTernary(ternary Ternary) (error, interface{}) {
+// VisitLogical short-circuits the logical operators. The result is the value of the operand
+// that decided the outcome rather than a boolean. Unlike or, ?? only skips its right operand
+// if the left operand is nil, so that e.g. false and 0 are kept.
+func (interpreter *Interpreter) VisitLogical(logical Logical) (error, interface{}) {
+	e, left := interpreter.visit(logical.Left)
+	if e != nil {
+		return e, nil
+	}
+
+	switch logical.Operator.Type {
+	case TokenQuestionQuestion:
+		if left != nil {
+			return nil, left
+		}
+	case TokenOr:
+		if interpreter.isTruthy(left) {
+			return nil, left
+		}
+	default:
+		if !interpreter.isTruthy(left) {
+			return nil, left
+		}
+	}
+	return interpreter.visit(logical.Right)
+}
+
+func (interpreter *Interpreter) VisitCall(call Call) (error, interface{}) {
+	e, callee := interpreter.visit(call.Callee)
+	if e != nil {
+		return e, nil
+	}
+
+	var arguments []interface{}
+	for _, argument := range call.Arguments {
+		e, value := interpreter.visit(argument)
+		if e != nil {
+			return e, nil
+		}
+		arguments = append(arguments, value)
+	}
+
+	function, isCallable := callee.(LoxCallable)
+	if !isCallable {
+		return RuntimeError{
+			Token: call.Paren,
+			Msg:   "Can only call functions and classes.",
+		}, nil
+	}
+	if len(arguments) != function.Arity() {
+		return RuntimeError{
+			Token: call.Paren,
+			Msg:   fmt.Sprintf("Expected %d arguments but got %d.", function.Arity(), len(arguments)),
+		}, nil
+	}
+
+	if interpreter.callDepth >= maxCallDepth {
+		return RuntimeError{
+			Token: call.Paren,
+			Msg:   "Stack overflow.",
+		}, nil
+	}
+	interpreter.callDepth++
+	e, result := function.Call(interpreter, arguments)
+	interpreter.callDepth--
+	if e != nil {
+		// Errors returned by native functions are reported at the call site.
+		if _, isRuntimeError := e.(RuntimeError); !isRuntimeError {
+			e = RuntimeError{
+				Token: call.Paren,
+				Msg:   e.Error(),
+			}
+		}
+		return e, nil
+	}
+	return nil, result
+}
+
+// maxCallDepth is the maximum number of calls that haven't returned yet. Each call
+// recurses through several Golang functions, so without a limit deep recursion in Lox,
+// e.g. a function without a base case, would overflow the Golang stack and crash.
+const maxCallDepth = 10000
+
+func (interpreter *Interpreter) VisitList(list List) (error, interface{}) {
+	elements := make([]interface{}, len(list.Elements))
+	for i, element := range list.Elements {
+		e, value := interpreter.visit(element)
+		if e != nil {
+			return e, nil
+		}
+		elements[i] = value
+	}
+	return nil, &LoxList{Elements: elements}
+}
+
+func (interpreter *Interpreter) VisitMap(expr Map) (error, interface{}) {
+	m := NewLoxMap()
+	for i := range expr.Keys {
+		e, key := interpreter.visit(expr.Keys[i])
+		if e != nil {
+			return e, nil
+		}
+		if e := mapKey(expr.Brace, key); e != nil {
+			return e, nil
+		}
+		e, value := interpreter.visit(expr.Values[i])
+		if e != nil {
+			return e, nil
+		}
+		m.Set(key, value)
+	}
+	return nil, m
+}
+
+func (interpreter *Interpreter) VisitIndex(expr Index) (error, interface{}) {
+	e, object := interpreter.visit(expr.Object)
+	if e != nil {
+		return e, nil
+	}
+	e, key := interpreter.visit(expr.Index)
+	if e != nil {
+		return e, nil
+	}
+
+	switch o := object.(type) {
+	case *LoxList:
+		e, i := index(expr.Bracket, key, len(o.Elements))
+		if e != nil {
+			return e, nil
+		}
+		return nil, o.Elements[i]
+	case string:
+		// Strings are indexed by character rather than byte.
+		runes := []rune(o)
+		e, i := index(expr.Bracket, key, len(runes))
+		if e != nil {
+			return e, nil
+		}
+		return nil, string(runes[i])
+	case *LoxMap:
+		if e := mapKey(expr.Bracket, key); e != nil {
+			return e, nil
+		}
+		value, found := o.Get(key)
+		if !found {
+			return RuntimeError{
+				Token: expr.Bracket,
+				Msg:   fmt.Sprintf("Undefined key %s.", stringify(key)),
+			}, nil
+		}
+		return nil, value
+	default:
+		return RuntimeError{
+			Token: expr.Bracket,
+			Msg:   "Only strings, lists and maps can be indexed.",
+		}, nil
+	}
+}
+
+func (interpreter *Interpreter) VisitSetIndex(expr SetIndex) (error, interface{}) {
+	e, object := interpreter.visit(expr.Object)
+	if e != nil {
+		return e, nil
+	}
+	e, key := interpreter.visit(expr.Index)
+	if e != nil {
+		return e, nil
+	}
+	e, value := interpreter.visit(expr.Value)
+	if e != nil {
+		return e, nil
+	}
+
+	switch o := object.(type) {
+	case *LoxList:
+		e, i := index(expr.Bracket, key, len(o.Elements))
+		if e != nil {
+			return e, nil
+		}
+		o.Elements[i] = value
+		return nil, value
+	case *LoxMap:
+		if e := mapKey(expr.Bracket, key); e != nil {
+			return e, nil
+		}
+		o.Set(key, value)
+		return nil, value
+	default:
+		return RuntimeError{
+			Token: expr.Bracket,
+			Msg:   "Only list and map elements can be assigned to.",
+		}, nil
+	}
+}
+
+func (interpreter *Interpreter) VisitGet(expr Get) (error, interface{}) {
+	e, object := interpreter.visit(expr.Object)
+	if e != nil {
+		return e, nil
+	}
+
+	if instance, isInstance := object.(*LoxInstance); isInstance {
+		return instance.Get(expr.Name)
+	}
+	return RuntimeError{
+		Token: expr.Name,
+		Msg:   "Only instances have properties.",
+	}, nil
+}
+
+func (interpreter *Interpreter) VisitSet(expr Set) (error, interface{}) {
+	e, object := interpreter.visit(expr.Object)
+	if e != nil {
+		return e, nil
+	}
+
+	instance, isInstance := object.(*LoxInstance)
+	if !isInstance {
+		return RuntimeError{
+			Token: expr.Name,
+			Msg:   "Only instances have fields.",
+		}, nil
+	}
+	e, value := interpreter.visit(expr.Value)
+	if e != nil {
+		return e, nil
+	}
+	instance.Set(expr.Name, value)
+	return nil, value
+}
+
+func (interpreter *Interpreter) VisitThis(expr This) (error, interface{}) {
+	return interpreter.lookUpVariable(expr.Keyword, expr.Resolution)
+}
+
+// VisitSuper looks up the method in the superclass of the class the enclosing method was
+// declared in, and binds it to the current instance.
+func (interpreter *Interpreter) VisitSuper(expr Super) (error, interface{}) {
+	depth := expr.Resolution.depth
+	e, value := interpreter.environment.GetAt(depth, expr.Keyword)
+	if e != nil {
+		return e, nil
+	}
+	superclass := value.(*LoxClass)
+	// The environment binding `this` is always just inside the one defining `super`.
+	this := expr.Keyword
+	this.Type, this.Lexeme = TokenThis, "this"
+	e, value = interpreter.environment.GetAt(depth-1, this)
+	if e != nil {
+		return e, nil
+	}
+	instance := value.(*LoxInstance)
+
+	method, found := superclass.findMethod(expr.Method.Lexeme)
+	if !found {
+		return RuntimeError{
+			Token: expr.Method,
+			Msg:   fmt.Sprintf("Undefined property '%s'.", expr.Method.Lexeme),
+		}, nil
+	}
+	return nil, method.bind(instance)
+}
+
+// VisitTernary evaluates only the branch that is selected by the truthiness of the condition,
+// like an if statement. Any value can be the condition, so the condition itself can't fail.
+func (interpreter *Interpreter) VisitTernary(ternary Ternary) (error, interface{}) {
 	e, cond := interpreter.visit(ternary.Cond)
 	if e != nil {
 		return e, nil
@@ -194,49 +660,436 @@ func (interpreter Interpreter) VisitTernary(ternary Ternary) (error, interface{}
 	}
 }
 
+func (interpreter *Interpreter) VisitFunction(stmt Function) (error, interface{}) {
+	// Functions are compared by identity, so we keep a pointer to the function.
+	function := &LoxFunction{
+		declaration: stmt,
+		closure:     interpreter.environment,
+	}
+	interpreter.environment.Define(stmt.Name.Lexeme, function)
+	return nil, nil
+}
+
+func (interpreter *Interpreter) VisitClass(stmt Class) (error, interface{}) {
+	var superclass *LoxClass
+	if stmt.Superclass != nil {
+		e, value := interpreter.visit(stmt.Superclass)
+		if e != nil {
+			return e, nil
+		}
+		class, isClass := value.(*LoxClass)
+		if !isClass {
+			return RuntimeError{
+				Token: stmt.Superclass.(Variable).Name,
+				Msg:   "Superclass must be a class.",
+			}, nil
+		}
+		superclass = class
+	}
+
+	// The methods of a subclass close over an environment in which `super` is defined.
+	closure := interpreter.environment
+	if superclass != nil {
+		closure = NewEnvironment(closure)
+		closure.Define("super", superclass)
+	}
+
+	methods := make(map[string]*LoxFunction, len(stmt.Methods))
+	for _, method := range stmt.Methods {
+		methods[method.Name.Lexeme] = &LoxFunction{
+			declaration:   method,
+			closure:       closure,
+			isInitializer: method.Name.Lexeme == "init",
+		}
+	}
+	interpreter.environment.Define(stmt.Name.Lexeme, &LoxClass{
+		Name:       stmt.Name.Lexeme,
+		superclass: superclass,
+		methods:    methods,
+	})
+	return nil, nil
+}
+
+func (interpreter *Interpreter) VisitLambda(expr Lambda) (error, interface{}) {
+	return nil, &LoxFunction{
+		declaration: expr.Declaration,
+		closure:     interpreter.environment,
+	}
+}
+
+// VisitInterpolation joins the parts of the string, which are printed like a print
+// statement prints them.
+func (interpreter *Interpreter) VisitInterpolation(expr Interpolation) (error, interface{}) {
+	s := strings.Builder{}
+	for _, part := range expr.Parts {
+		e, value := interpreter.visit(part)
+		if e != nil {
+			return e, nil
+		}
+		s.WriteString(interpreter.stringify(value))
+	}
+	return nil, s.String()
+}
+
+func (interpreter *Interpreter) VisitReturn(stmt Return) (error, interface{}) {
+	var value interface{}
+	if stmt.Value != nil {
+		var e error
+		if e, value = interpreter.visit(stmt.Value); e != nil {
+			return e, nil
+		}
+	}
+
+	panic(returnValue{Value: value})
+}
+
+func (interpreter *Interpreter) VisitBlock(block Block) (error, interface{}) {
+	return interpreter.executeBlock(block.Statements, NewEnvironment(interpreter.environment))
+}
+
+// executeBlock executes the statements in the given environment. The current environment
+// is restored afterwards, also when execution is aborted by an error.
+func (interpreter *Interpreter) executeBlock(statements []Stmt, environment *Environment) (error, interface{}) {
+	previous := interpreter.environment
+	defer func() {
+		interpreter.environment = previous
+	}()
+
+	interpreter.environment = environment
+	for _, stmt := range statements {
+		if e, _ := interpreter.execute(stmt); e != nil {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (interpreter *Interpreter) VisitIf(stmt If) (error, interface{}) {
+	e, cond := interpreter.visit(stmt.Condition)
+	if e != nil {
+		return e, nil
+	}
+
+	if interpreter.isTruthy(cond) {
+		return interpreter.execute(stmt.ThenBranch)
+	} else if stmt.ElseBranch != nil {
+		return interpreter.execute(stmt.ElseBranch)
+	}
+	return nil, nil
+}
+
+func (interpreter *Interpreter) VisitWhile(stmt While) (error, interface{}) {
+	for {
+		e, cond := interpreter.visit(stmt.Condition)
+		if e != nil {
+			return e, nil
+		}
+		if !interpreter.isTruthy(cond) {
+			return nil, nil
+		}
+
+		e, broke := interpreter.executeLoopBody(stmt.Body)
+		if e != nil {
+			return e, nil
+		}
+		if broke {
+			return nil, nil
+		}
+
+		if stmt.Increment != nil {
+			if e, _ := interpreter.visit(stmt.Increment); e != nil {
+				return e, nil
+			}
+		}
+	}
+}
+
+// VisitSwitch executes the body of the first case that equals the subject, or the default if
+// no case does. The cases are evaluated in order until one matches.
+func (interpreter *Interpreter) VisitSwitch(stmt Switch) (error, interface{}) {
+	e, subject := interpreter.visit(stmt.Subject)
+	if e != nil {
+		return e, nil
+	}
+
+	for i, value := range stmt.Cases {
+		e, caseValue := interpreter.visit(value)
+		if e != nil {
+			return e, nil
+		}
+		if interpreter.isEqual(subject, caseValue) {
+			return interpreter.execute(stmt.Bodies[i])
+		}
+	}
+	if stmt.Default != nil {
+		return interpreter.execute(stmt.Default)
+	}
+	return nil, nil
+}
+
+// VisitDoWhile runs the body before checking the condition, so it runs at least once.
+// A continue statement skips to the condition.
+func (interpreter *Interpreter) VisitDoWhile(stmt DoWhile) (error, interface{}) {
+	for {
+		e, broke := interpreter.executeLoopBody(stmt.Body)
+		if e != nil {
+			return e, nil
+		}
+		if broke {
+			return nil, nil
+		}
+
+		e, cond := interpreter.visit(stmt.Condition)
+		if e != nil {
+			return e, nil
+		}
+		if !interpreter.isTruthy(cond) {
+			return nil, nil
+		}
+	}
+}
+
+// executeLoopBody executes a single iteration of a loop. Break and continue statements
+// unwind the stack up to here; broke reports whether the loop should stop.
+func (interpreter *Interpreter) executeLoopBody(body Stmt) (e error, broke bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch r.(type) {
+			case breakSignal:
+				e, broke = nil, true
+			case continueSignal:
+				e, broke = nil, false
+			default:
+				panic(r)
+			}
+		}
+	}()
+
+	e, _ = interpreter.execute(body)
+	return e, false
+}
+
+// Sentinels used to unwind the interpreter from a break or continue statement to the loop.
+type breakSignal struct{}
+type continueSignal struct{}
+
+func (interpreter *Interpreter) VisitBreak(stmt Break) (error, interface{}) {
+	panic(breakSignal{})
+}
+
+func (interpreter *Interpreter) VisitContinue(stmt Continue) (error, interface{}) {
+	panic(continueSignal{})
+}
+
+func (interpreter *Interpreter) VisitVariable(variable Variable) (error, interface{}) {
+	return interpreter.lookUpVariable(variable.Name, variable.Resolution)
+}
+
+func (interpreter *Interpreter) VisitAssign(assign Assign) (error, interface{}) {
+	e, value := interpreter.visit(assign.Value)
+	if e != nil {
+		return e, nil
+	}
+
+	if assign.Resolution.isLocal {
+		e = interpreter.environment.AssignAt(assign.Resolution.depth, assign.Name, value)
+	} else {
+		e = interpreter.globals.Assign(assign.Name, value)
+	}
+	if e != nil {
+		return e, nil
+	}
+	return nil, value
+}
+
 // Lox implements truthy as anything that is not nil and not false (strict boolean).
 // This mimics Ruby's definition of truthy.
-func (interpreter Interpreter) isTruthy(right interface{}) bool {
+func (interpreter *Interpreter) isTruthy(right interface{}) bool {
 	if right == nil {
 		return false
 	}
 
-	switch t := right.(type) {
-	case Boolean:
-		return t.V
-	default:
-		return true
+	if b, isBool := right.(bool); isBool {
+		return b
+	}
+	return true
+}
+
+// assertNumber asserts that the value is a number. Integers are converted to floating point.
+func (interpreter *Interpreter) assertNumber(operator Token, v interface{}) (error, float64) {
+	if number, isNumber := toFloat(v); isNumber {
+		return nil, number
 	}
+	return RuntimeError{
+		Token: operator,
+		Msg:   "operand must be a number.",
+	}, 0
 }
 
-func (interpreter Interpreter) assertNumber(operator Token, v interface{}) (error, float64) {
+// toFloat converts an integer or floating point number to floating point.
+func toFloat(v interface{}) (float64, bool) {
 	switch t := v.(type) {
-	case Number:
-		return nil, t.V
 	case float64:
-		return nil, t
+		return t, true
+	case int64:
+		return float64(t), true
 	default:
+		return 0, false
+	}
+}
+
+// integers returns both values if they are integers. Arithmetic on two integers stays
+// integral, otherwise the operands are converted to floating point.
+func integers(left interface{}, right interface{}) (int64, int64, bool) {
+	leftV, leftIsInteger := left.(int64)
+	rightV, rightIsInteger := right.(int64)
+	return leftV, rightV, leftIsInteger && rightIsInteger
+}
+
+// additionOverflows, subtractionOverflows and multiplicationOverflows report whether the
+// result of the integer operation doesn't fit in an int64. Such arithmetic is done in
+// floating point instead, rather than wrapping around.
+func additionOverflows(a, b int64) bool {
+	sum := a + b
+	return (a > 0 && b > 0 && sum < 0) || (a < 0 && b < 0 && sum >= 0)
+}
+
+func subtractionOverflows(a, b int64) bool {
+	difference := a - b
+	return (a >= 0 && b < 0 && difference < 0) || (a < 0 && b > 0 && difference >= 0)
+}
+
+func multiplicationOverflows(a, b int64) bool {
+	if a == 0 || b == 0 {
+		return false
+	}
+	product := a * b
+	return product/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64)
+}
+
+// integerPower raises the base to the non-negative exponent by repeated squaring. It
+// reports whether the result fits in an int64.
+func integerPower(base, exponent int64) (int64, bool) {
+	result := int64(1)
+	for exponent > 0 {
+		if exponent&1 == 1 {
+			if multiplicationOverflows(result, base) {
+				return 0, false
+			}
+			result *= base
+		}
+		exponent >>= 1
+		if exponent > 0 {
+			if multiplicationOverflows(base, base) {
+				return 0, false
+			}
+			base *= base
+		}
+	}
+	return result, true
+}
+
+// assertInteger asserts that the value is a whole number, which bitwise operators and
+// integer division operate on.
+func (interpreter *Interpreter) assertInteger(operator Token, v interface{}) (error, int64) {
+	if integer, isInteger := v.(int64); isInteger {
+		return nil, integer
+	}
+	e, number := interpreter.assertNumber(operator, v)
+	if e != nil {
+		return e, 0
+	}
+	operands := "Operands of bitwise operators"
+	if operator.Type == TokenDiv {
+		operands = "Operands of integer division"
+	}
+	if number != math.Trunc(number) {
+		return RuntimeError{
+			Token: operator,
+			Msg:   operands + " must be whole numbers.",
+		}, 0
+	}
+	// Beyond this range a floating point number may not be the integer that was meant, and
+	// it may not even fit in an integer.
+	if math.Abs(number) > maxExactInteger {
 		return RuntimeError{
 			Token: operator,
-			Msg:   "operand must be a number.",
+			Msg:   operands + " must be integers or floating point numbers within ±2^53.",
 		}, 0
 	}
+	return nil, int64(number)
+}
+
+// maxExactInteger is the largest integer up to which all integers can be represented
+// exactly as a floating point number.
+const maxExactInteger = 1 << 53
+
+func (interpreter *Interpreter) assertString(operator Token, v interface{}) (error, string) {
+	if s, isString := v.(string); isString {
+		return nil, s
+	}
+	return RuntimeError{
+		Token: operator,
+		Msg:   "operand must be string",
+	}, ""
+}
+
+// repeat concatenates count copies of str. The count must be a non-negative whole number.
+func (interpreter *Interpreter) repeat(operator Token, str string, count interface{}) (error, interface{}) {
+	e, n := interpreter.assertNumber(operator, count)
+	if e != nil {
+		return e, nil
+	}
+	if n < 0 || n != math.Trunc(n) || math.IsInf(n, 0) {
+		return RuntimeError{
+			Token: operator,
+			Msg:   "String repetition count must be a non-negative whole number.",
+		}, nil
+	}
+	// Compared as floating point numbers, so that huge counts can't overflow.
+	if float64(len(str))*n > maxStringLength || n > maxStringLength {
+		return RuntimeError{
+			Token: operator,
+			Msg:   fmt.Sprintf("String repetition can't make strings longer than %d bytes.", maxStringLength),
+		}, nil
+	}
+	return nil, strings.Repeat(str, int(n))
 }
 
-func (interpreter Interpreter) assertString(v interface{}) (error, string) {
+// maxStringLength is the length in bytes up to which strings can be repeated.
+const maxStringLength = 1 << 30
+
+func (interpreter *Interpreter) isEqual(left interface{}, right interface{}) bool {
+	return normalize(left) == normalize(right)
+}
+
+// unwrap converts the literal wrappers to the Golang values they wrap.
+//
+// The wrappers only exist in the AST, so that literals can be printed. At runtime every
+// value is a plain Golang value: nil, bool, int64, float64, string, or a pointer or struct
+// for lists, maps, functions, classes and instances. Values enter the runtime through
+// literals and the return values of host functions, both of which are unwrapped, so the
+// rest of the interpreter never has to handle both representations.
+func unwrap(v interface{}) interface{} {
 	switch t := v.(type) {
+	case Number:
+		return t.V
+	case Integer:
+		return t.V
 	case String:
-		return nil, t.V
-	case string:
-		return nil, t
+		return t.V
+	case Boolean:
+		return t.V
 	default:
-		return RuntimeError{
-			Token: Token{},
-			Msg:   "operand must be string",
-		}, ""
+		return v
 	}
 }
 
-func (interpreter Interpreter) isEqual(left interface{}, right interface{}) bool {
-	return left == right
+// normalize converts whole floating point numbers to integers, so
+// that equal numbers compare equal and are the same map key, e.g. 1 and 1.0.
+func normalize(v interface{}) interface{} {
+	if f, isFloat := v.(float64); isFloat && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return int64(f)
+	}
+	return v
 }
@@ -0,0 +1,1499 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// interpret runs the source code and returns the interpreter so that the final state of
+// the global environment can be inspected.
+func interpret(t *testing.T, source string) *Interpreter {
+	reporter := StateErrorReporter{}
+	frontend := NewFrontend([]byte(source), &reporter)
+	statements := frontend.Parse()
+	if reporter.HadError {
+		t.Fatal("unexpected parse error")
+	}
+
+	interpreter := NewInterpreter(&reporter, nil)
+	resolver := NewResolver(&interpreter, &reporter)
+	if e := resolver.Resolve(statements); e != nil {
+		t.Fatal("unexpected resolve error")
+	}
+	interpreter.Execute(statements)
+	if reporter.HadRuntimeError {
+		t.Fatal("unexpected runtime error")
+	}
+	return &interpreter
+}
+
+// evaluate parses the source code as a single expression and returns its value.
+func evaluate(t *testing.T, source string) (error, interface{}) {
+	reporter := StateErrorReporter{}
+	scanner := NewScanner([]byte(source), &reporter)
+	parser := NewParser(scanner.ScanTokens(), &reporter)
+	expr, _ := parser.ParseExpression()
+	if reporter.HadError {
+		t.Fatal("unexpected parse error")
+	}
+
+	interpreter := NewInterpreter(&reporter, nil)
+	resolver := NewResolver(&interpreter, &reporter)
+	if e := resolver.ResolveExpression(expr); e != nil {
+		t.Fatal("unexpected resolve error")
+	}
+	return interpreter.visit(expr)
+}
+
+// global returns the value of a global variable.
+func global(t *testing.T, interpreter *Interpreter, name string) interface{} {
+	e, value := interpreter.environment.Get(Token{Type: TokenIdentifier, Lexeme: name})
+	if e != nil {
+		t.Fatal(e)
+	}
+	return value
+}
+
+func TestBlockShadowing(t *testing.T) {
+	interpreter := interpret(t, `
+var a = "outer";
+var inner;
+{
+	var a = "inner";
+	inner = a;
+}
+`)
+
+	if a := global(t, interpreter, "a"); a != "outer" {
+		t.Errorf("expected outer a to be unchanged, got %v", a)
+	}
+	if inner := global(t, interpreter, "inner"); inner != "inner" {
+		t.Errorf("expected inner a to shadow outer a, got %v", inner)
+	}
+}
+
+func TestWhileLoop(t *testing.T) {
+	interpreter := interpret(t, `
+var iterations = 0;
+var checks = 0;
+while ((checks = checks + 1) <= 5) {
+	iterations = iterations + 1;
+}
+`)
+
+	if iterations := global(t, interpreter, "iterations"); iterations != int64(5) {
+		t.Errorf("expected 5 iterations, got %v", iterations)
+	}
+	// The condition is checked before every iteration and once more to exit the loop.
+	if checks := global(t, interpreter, "checks"); checks != int64(6) {
+		t.Errorf("expected the condition to be evaluated 6 times, got %v", checks)
+	}
+}
+
+func TestClock(t *testing.T) {
+	interpreter := interpret(t, `
+var first = clock();
+var second = clock();
+`)
+
+	first := global(t, interpreter, "first").(float64)
+	second := global(t, interpreter, "second").(float64)
+	if second < first {
+		t.Errorf("expected clock to be monotonic, got %f then %f", first, second)
+	}
+}
+
+func TestAddition(t *testing.T) {
+	if e, sum := evaluate(t, "1 + 2"); e != nil || sum != int64(3) {
+		t.Errorf("expected 1 + 2 to be 3, got %v (error: %v)", sum, e)
+	}
+	if e, _ := evaluate(t, `1 + "a"`); e == nil {
+		t.Error(`expected a runtime error for 1 + "a"`)
+	} else if _, isRuntimeError := e.(RuntimeError); !isRuntimeError {
+		t.Errorf(`expected a runtime error for 1 + "a", got %v`, e)
+	}
+}
+
+func TestEquality(t *testing.T) {
+	interpreter := NewInterpreter(&StateErrorReporter{}, nil)
+	tests := []struct {
+		left, right interface{}
+		equal       bool
+	}{
+		{1.0, 1.0, true},
+		{int64(1), 1.0, true},
+		{int64(1), int64(2), false},
+		{"a", "a", true},
+		{"a", "b", false},
+		{true, true, true},
+		{nil, nil, true},
+		{nil, false, false},
+		{1.0, "1", false},
+		{0.0, false, false},
+		{"nil", nil, false},
+	}
+
+	for _, test := range tests {
+		if equal := interpreter.isEqual(test.left, test.right); equal != test.equal {
+			t.Errorf("expected isEqual(%#v, %#v) to be %v", test.left, test.right, test.equal)
+		}
+	}
+	if e, equal := evaluate(t, "1 == 1"); e != nil || equal != true {
+		t.Errorf("expected 1 == 1 to be true, got %v (error: %v)", equal, e)
+	}
+}
+
+// Natives compare by identity, like functions declared in Lox.
+func TestNativeEquality(t *testing.T) {
+	tests := map[string]bool{
+		"upper == upper": true,
+		"upper == lower": false,
+		"len == len":     true,
+		"clock == len":   false,
+		"sqrt == 1":      false,
+	}
+	for source, expected := range tests {
+		if e, equal := evaluate(t, source); e != nil || equal != expected {
+			t.Errorf("expected %s to be %v, got %v (error: %v)", source, expected, equal, e)
+		}
+	}
+
+	interpreter := interpret(t, `
+var matched = "none";
+switch (len) {
+	case upper: matched = "upper";
+	case len: matched = "len";
+}
+`)
+	if matched := global(t, interpreter, "matched"); matched != "len" {
+		t.Errorf("expected len to match itself in a switch, got %v", matched)
+	}
+}
+
+// Unbounded recursion is a runtime error rather than a crash of the Golang stack.
+func TestStackOverflow(t *testing.T) {
+	reporter := CollectingErrorReporter{}
+	frontend := NewFrontend([]byte("fun f() { return f(); }\nf();"), &reporter)
+	interpreter := NewInterpreter(&reporter, nil)
+	interpreter.Execute(frontend.Parse())
+	errors := reporter.Errors()
+	if len(errors) != 1 || errors[0].Message != "Stack overflow." || errors[0].Line != 1 || errors[0].Column != 20 {
+		t.Fatalf("expected a stack overflow at the recursive call, got %v", errors)
+	}
+
+	// The depth is unwound by the error, so deep but bounded recursion still works.
+	reporter = CollectingErrorReporter{}
+	frontend = NewFrontend([]byte("fun count(n) { if (n == 0) return 0; return 1 + count(n - 1); }\nvar n = count(5000);"), &reporter)
+	statements := frontend.Parse()
+	resolver := NewResolver(&interpreter, &reporter)
+	if e := resolver.Resolve(statements); e != nil {
+		t.Fatal(e)
+	}
+	interpreter.Execute(statements)
+	if errors := reporter.Errors(); len(errors) > 0 {
+		t.Fatalf("unexpected errors %v", errors)
+	}
+	if n := global(t, &interpreter, "n"); n != int64(5000) {
+		t.Errorf("expected count(5000) to be 5000, got %v", n)
+	}
+}
+
+func TestDivision(t *testing.T) {
+	if e, quotient := evaluate(t, "6 / 4"); e != nil || quotient != 1.5 {
+		t.Errorf("expected 6 / 4 to be 1.5, got %v (error: %v)", quotient, e)
+	}
+	for _, source := range []string{"1 / 0", "0 / 0"} {
+		if e, _ := evaluate(t, source); e == nil {
+			t.Errorf("expected a runtime error for %s", source)
+		} else if runtimeError, isRuntimeError := e.(RuntimeError); !isRuntimeError || runtimeError.Msg != "Division by zero." {
+			t.Errorf("expected a division by zero error for %s, got %v", source, e)
+		}
+	}
+}
+
+func TestStringRepetition(t *testing.T) {
+	tests := map[string]string{
+		`"x" * 0`:  "",
+		`"x" * 3`:  "xxx",
+		`2 * "ab"`: "abab",
+	}
+	for source, expected := range tests {
+		if e, repeated := evaluate(t, source); e != nil || repeated != expected {
+			t.Errorf("expected %s to be %q, got %v (error: %v)", source, expected, repeated, e)
+		}
+	}
+	for _, source := range []string{`"x" * 2.5`, `"x" * -1`, `"x" * "y"`} {
+		if e, _ := evaluate(t, source); e == nil {
+			t.Errorf("expected a runtime error for %s", source)
+		}
+	}
+	for _, source := range []string{`"x" * 9223372036854775807`, `"x" * 2 ** 40`, `"abc" * 2 ** 29`} {
+		if e, _ := evaluate(t, source); e == nil || !strings.HasPrefix(e.Error(), "String repetition can't make strings longer") {
+			t.Errorf("expected a string length error for %s, got %v", source, e)
+		}
+	}
+	if e, product := evaluate(t, "2 * 3"); e != nil || product != int64(6) {
+		t.Errorf("expected 2 * 3 to be 6, got %v (error: %v)", product, e)
+	}
+}
+
+func TestPrintOutput(t *testing.T) {
+	reporter := StateErrorReporter{}
+	frontend := NewFrontend([]byte(`print 1 + 2; print "a" + "b"; print nil;`), &reporter)
+	statements := frontend.Parse()
+
+	out := bytes.Buffer{}
+	interpreter := NewInterpreter(&reporter, &out)
+	interpreter.Execute(statements)
+	if reporter.HadError || reporter.HadRuntimeError {
+		t.Fatal("unexpected error")
+	}
+	if printed := out.String(); printed != "3\nab\nnil\n" {
+		t.Errorf("unexpected output %q", printed)
+	}
+}
+
+func TestPrintSeveralValues(t *testing.T) {
+	reporter := StateErrorReporter{}
+	frontend := NewFrontend([]byte(`print 1, "x", true; print (1, 2), 3;`), &reporter)
+	statements := frontend.Parse()
+
+	out := bytes.Buffer{}
+	interpreter := NewInterpreter(&reporter, &out)
+	interpreter.Execute(statements)
+	if reporter.HadError || reporter.HadRuntimeError {
+		t.Fatal("unexpected error")
+	}
+	if printed := out.String(); printed != "1 x true\n2 3\n" {
+		t.Errorf("unexpected output %q", printed)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	reporter := StateErrorReporter{}
+	frontend := NewFrontend([]byte(`write("a"); write("b"); write(1); print "";`), &reporter)
+	statements := frontend.Parse()
+
+	out := bytes.Buffer{}
+	interpreter := NewInterpreter(&reporter, &out)
+	interpreter.Execute(statements)
+	if reporter.HadError || reporter.HadRuntimeError {
+		t.Fatal("unexpected error")
+	}
+	if printed := out.String(); printed != "ab1\n" {
+		t.Errorf("unexpected output %q", printed)
+	}
+}
+
+func TestNumberFormatting(t *testing.T) {
+	// The fixed form with 6 decimals is what Golang's %f prints.
+	tests := []struct {
+		source, shortest, fixed string
+	}{
+		{"0.1 + 0.2", "0.30000000000000004", "0.300000"},
+		{"1 / 3", "0.3333333333333333", "0.333333"},
+		{"2.5", "2.5", "2.500000"},
+		{"1.0", "1", "1.000000"},
+		{"0.0000001", "1e-07", "0.000000"},
+		{"7", "7", "7"},
+		{"[0.5, 1 / 4]", "[0.5, 0.25]", "[0.500000, 0.250000]"},
+	}
+	for _, test := range tests {
+		for decimals, expected := range map[int]string{ShortestDecimals: test.shortest, 6: test.fixed} {
+			// The str native converts numbers the same way as print.
+			reporter := StateErrorReporter{}
+			frontend := NewFrontend([]byte("print "+test.source+", str("+test.source+");"), &reporter)
+			out := bytes.Buffer{}
+			interpreter := NewInterpreter(&reporter, &out)
+			interpreter.Decimals = decimals
+			interpreter.Execute(frontend.Parse())
+			if printed := out.String(); printed != expected+" "+expected+"\n" {
+				t.Errorf("expected %s to print %s with %d decimals, got %q", test.source, expected, decimals, printed)
+			}
+		}
+	}
+}
+
+func TestRegisterNative(t *testing.T) {
+	reporter := StateErrorReporter{}
+	frontend := NewFrontend([]byte(`var sum = add(1, 2);`), &reporter)
+	statements := frontend.Parse()
+
+	interpreter := NewInterpreter(&reporter, nil)
+	interpreter.RegisterNative("add", 2, func(args []interface{}) (interface{}, error) {
+		a, aIsNumber := args[0].(float64)
+		b, bIsNumber := args[1].(float64)
+		if !aIsNumber || !bIsNumber {
+			return nil, errors.New("add expects two numbers")
+		}
+		return a + b, nil
+	})
+	interpreter.Execute(statements)
+	if reporter.HadError || reporter.HadRuntimeError {
+		t.Fatal("unexpected error")
+	}
+	if sum := global(t, &interpreter, "sum"); sum != 3.0 {
+		t.Errorf("expected add(1, 2) to be 3, got %v", sum)
+	}
+
+	frontend = NewFrontend([]byte(`add("a", 2);`), &reporter)
+	interpreter.Execute(frontend.Parse())
+	if !reporter.HadRuntimeError {
+		t.Error("expected the native error to be raised as a runtime error")
+	}
+
+	// Wrapped values returned by the host are unwrapped, so they compare equal to literals.
+	interpreter.RegisterNative("name", 0, func(args []interface{}) (interface{}, error) {
+		return String{V: "lox"}, nil
+	})
+	frontend = NewFrontend([]byte(`var isLox = name() == "lox";`), &reporter)
+	interpreter.Execute(frontend.Parse())
+	if isLox := global(t, &interpreter, "isLox"); isLox != true {
+		t.Errorf("expected the returned String to equal a string literal, got %v", isLox)
+	}
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	interpreter := interpret(t, `
+var a = 1;
+a += 2;
+var b = 10;
+b -= 4;
+var c = 3;
+c *= 5;
+var d = 9;
+d /= 2;
+var s = "hi";
+s += "!";
+var e = 1;
+var f = (e += 1) + e;
+`)
+
+	tests := map[string]interface{}{
+		"a": int64(3),
+		"b": int64(6),
+		"c": int64(15),
+		"d": 4.5,
+		"s": "hi!",
+		"e": int64(2),
+		"f": int64(4),
+	}
+	for name, expected := range tests {
+		if value := global(t, interpreter, name); value != expected {
+			t.Errorf("expected %s to be %v, got %v", name, expected, value)
+		}
+	}
+}
+
+func TestCompoundAssignmentInvalidTarget(t *testing.T) {
+	reporter := CollectingErrorReporter{}
+	frontend := NewFrontend([]byte("var a = 1; (a) += 1;"), &reporter)
+	frontend.Parse()
+
+	errors := reporter.Errors()
+	if len(errors) != 1 || errors[0].Message != "Invalid assignment target." {
+		t.Errorf("expected an invalid assignment target error, got %v", errors)
+	}
+}
+
+func TestBreak(t *testing.T) {
+	interpreter := interpret(t, `
+var iterations = 0;
+while (true) {
+	iterations += 1;
+	if (iterations == 3) break;
+}
+var last;
+for (var i = 0; i < 10; i += 1) {
+	last = i;
+	if (i == 4) { break; }
+}
+`)
+
+	if iterations := global(t, interpreter, "iterations"); iterations != int64(3) {
+		t.Errorf("expected the loop to break after 3 iterations, got %v", iterations)
+	}
+	if last := global(t, interpreter, "last"); last != int64(4) {
+		t.Errorf("expected the for loop to break at 4, got %v", last)
+	}
+}
+
+func TestContinue(t *testing.T) {
+	interpreter := interpret(t, `
+var sum = 0;
+for (var i = 1; i <= 10; i += 1) {
+	if (i > 3 and i < 8) continue;
+	sum += i;
+}
+var reached = 0;
+var n = 0;
+while (n < 10) {
+	n += 1;
+	if (n > 4) continue;
+	reached += 1;
+}
+`)
+
+	// The increment still runs after continue, otherwise the loop would never end.
+	if sum := global(t, interpreter, "sum"); sum != int64(1+2+3+8+9+10) {
+		t.Errorf("expected 4 to 7 to be skipped, got a sum of %v", sum)
+	}
+	if n := global(t, interpreter, "n"); n != int64(10) {
+		t.Errorf("expected the while loop to run 10 times, got %v", n)
+	}
+	if reached := global(t, interpreter, "reached"); reached != int64(4) {
+		t.Errorf("expected 4 iterations to reach the end of the body, got %v", reached)
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	reporter := CollectingErrorReporter{}
+	frontend := NewFrontend([]byte("break; while (true) { fun f() { continue; } }"), &reporter)
+	frontend.Parse()
+
+	errors := reporter.Errors()
+	if len(errors) != 2 {
+		t.Fatalf("expected 2 errors, got %v", errors)
+	}
+	if errors[0].Message != "Can't use 'break' outside of a loop." {
+		t.Errorf("unexpected error %v", errors[0])
+	}
+	if errors[1].Message != "Can't use 'continue' outside of a loop." {
+		t.Errorf("unexpected error %v", errors[1])
+	}
+}
+
+func TestLists(t *testing.T) {
+	interpreter := interpret(t, `
+var empty = [];
+var xs = [1, "two", [3, 4]];
+var first = xs[0];
+var nested = xs[2][1];
+xs[1] = 2;
+var second = xs[1];
+var alias = xs;
+alias[0] = "changed";
+`)
+
+	if empty := global(t, interpreter, "empty").(*LoxList); len(empty.Elements) != 0 {
+		t.Errorf("expected an empty list, got %v", empty)
+	}
+	tests := map[string]interface{}{
+		"first":  int64(1),
+		"nested": int64(4),
+		"second": int64(2),
+	}
+	for name, expected := range tests {
+		if value := global(t, interpreter, name); value != expected {
+			t.Errorf("expected %s to be %v, got %v", name, expected, value)
+		}
+	}
+	// Lists are shared by reference.
+	if xs := global(t, interpreter, "xs").(*LoxList); xs.Elements[0] != "changed" {
+		t.Errorf("expected the list to be changed through its alias, got %v", xs)
+	}
+	if printed := stringify(global(t, interpreter, "xs")); printed != "[changed, 2, [3, 4]]" {
+		t.Errorf("unexpected printed list %s", printed)
+	}
+}
+
+// A list that contains itself is printed as [...] where it repeats. A list that is only
+// contained twice, but not in itself, is printed in full.
+func TestPrintListCycles(t *testing.T) {
+	interpreter := interpret(t, `
+var a = [1];
+a[0] = a;
+var b = [1, 2];
+b[1] = [b, 3];
+var shared = [4];
+var twice = [shared, shared];
+`)
+	tests := map[string]string{
+		"a":     "[[...]]",
+		"b":     "[1, [[...], 3]]",
+		"twice": "[[4], [4]]",
+	}
+	for name, expected := range tests {
+		if printed := stringify(global(t, interpreter, name)); printed != expected {
+			t.Errorf("expected %s to be printed as %s, got %s", name, expected, printed)
+		}
+	}
+}
+
+func TestListIndexErrors(t *testing.T) {
+	for _, source := range []string{"[1, 2][2]", "[1, 2][-1]", "[1, 2][0.5]", `[1, 2]["0"]`, "1[0]"} {
+		if e, value := evaluate(t, source); e == nil {
+			t.Errorf("expected a runtime error for %s, got %v", source, value)
+		} else if _, isRuntimeError := e.(RuntimeError); !isRuntimeError {
+			t.Errorf("expected a runtime error for %s, got %v", source, e)
+		}
+	}
+}
+
+func TestMaps(t *testing.T) {
+	interpreter := interpret(t, `
+var empty = {};
+var m = {"a": 1, 2: "two", true: [3]};
+var a = m["a"];
+var two = m[2];
+var three = m[true][0];
+m["a"] = "updated";
+m["new"] = nil;
+var updated = m["a"];
+`)
+
+	if empty := global(t, interpreter, "empty").(*LoxMap); empty.Len() != 0 {
+		t.Errorf("expected an empty map, got %v", empty)
+	}
+	tests := map[string]interface{}{
+		"a":       int64(1),
+		"two":     "two",
+		"three":   int64(3),
+		"updated": "updated",
+	}
+	for name, expected := range tests {
+		if value := global(t, interpreter, name); value != expected {
+			t.Errorf("expected %s to be %v, got %v", name, expected, value)
+		}
+	}
+	if printed := stringify(global(t, interpreter, "m")); printed != "{a: updated, 2: two, true: [3], new: nil}" {
+		t.Errorf("unexpected printed map %s", printed)
+	}
+}
+
+// Like lists, a map that contains itself, also through a list, is printed as {...} where
+// it repeats.
+func TestPrintMapCycles(t *testing.T) {
+	interpreter := interpret(t, `
+var m = {};
+m["x"] = m;
+var n = {"a": 1};
+n["list"] = [n, {"b": n}];
+`)
+	tests := map[string]string{
+		"m": "{x: {...}}",
+		"n": "{a: 1, list: [{...}, {b: {...}}]}",
+	}
+	for name, expected := range tests {
+		if printed := stringify(global(t, interpreter, name)); printed != expected {
+			t.Errorf("expected %s to be printed as %s, got %s", name, expected, printed)
+		}
+	}
+}
+
+func TestMapErrors(t *testing.T) {
+	for _, source := range []string{`{"a": 1}["b"]`, `{[1]: 1}`, `{"a": 1}[[1]]`, `{"a": 1}[nil]`} {
+		if e, value := evaluate(t, source); e == nil {
+			t.Errorf("expected a runtime error for %s, got %v", source, value)
+		} else if _, isRuntimeError := e.(RuntimeError); !isRuntimeError {
+			t.Errorf("expected a runtime error for %s, got %v", source, e)
+		}
+	}
+}
+
+func TestStringIndexAndLength(t *testing.T) {
+	tests := map[string]interface{}{
+		`len("héllo")`:              int64(5),
+		`len("")`:                   int64(0),
+		`len([1, 2, 3])`:            int64(3),
+		`len({"a": 1})`:             int64(1),
+		`"abc"[1]`:                  "b",
+		`"héllo"[1]`:                "é",
+		`"héllo"[len("héllo") - 1]`: "o",
+	}
+	for source, expected := range tests {
+		if e, value := evaluate(t, source); e != nil || value != expected {
+			t.Errorf("expected %s to be %v, got %v (error: %v)", source, expected, value, e)
+		}
+	}
+
+	for _, source := range []string{`"abc"[3]`, `"abc"[-1]`, `""[0]`, `len(1)`} {
+		if e, value := evaluate(t, source); e == nil {
+			t.Errorf("expected a runtime error for %s, got %v", source, value)
+		}
+	}
+}
+
+func TestThis(t *testing.T) {
+	interpreter := interpret(t, `
+class Counter {
+	add(n) {
+		this.x = this.x + n;
+		return this;
+	}
+	get() {
+		return this.x;
+	}
+}
+var counter = Counter();
+counter.x = 1;
+var total = counter.add(2).add(3).get();
+var method = counter.get;
+var bound = method();
+`)
+
+	if total := global(t, interpreter, "total"); total != int64(6) {
+		t.Errorf("expected total to be 6, got %v", total)
+	}
+	if bound := global(t, interpreter, "bound"); bound != int64(6) {
+		t.Errorf("expected the method to stay bound to the instance, got %v", bound)
+	}
+}
+
+func TestThisOutsideClass(t *testing.T) {
+	reporter := CollectingErrorReporter{}
+	frontend := NewFrontend([]byte("print this; fun f() { return this; }"), &reporter)
+	frontend.Parse()
+
+	errors := reporter.Errors()
+	if len(errors) != 2 {
+		t.Fatalf("expected 2 errors, got %v", errors)
+	}
+	for _, e := range errors {
+		if e.Message != "Can't use 'this' outside of a class." {
+			t.Errorf("unexpected error %v", e)
+		}
+	}
+}
+
+func TestInitializer(t *testing.T) {
+	interpreter := interpret(t, `
+class Point {
+	init(x, y) {
+		this.x = x;
+		this.y = y;
+		if (x == 0) return;
+		this.origin = false;
+	}
+}
+var p = Point(1, 2);
+var sum = p.x + p.y;
+var origin = Point(0, 0);
+var reinit = p.init(3, 4);
+`)
+
+	if sum := global(t, interpreter, "sum"); sum != int64(3) {
+		t.Errorf("expected the arguments to be passed to init, got %v", sum)
+	}
+	origin := global(t, interpreter, "origin")
+	if _, isInstance := origin.(*LoxInstance); !isInstance {
+		t.Errorf("expected a bare return in init to return the instance, got %v", origin)
+	}
+	if reinit := global(t, interpreter, "reinit"); reinit != global(t, interpreter, "p") {
+		t.Errorf("expected calling init to return the instance, got %v", reinit)
+	}
+}
+
+func TestInitializerArity(t *testing.T) {
+	reporter := CollectingErrorReporter{}
+	frontend := NewFrontend([]byte("class A { init(a) {} } A();"), &reporter)
+	interpreter := NewInterpreter(&reporter, nil)
+	interpreter.Execute(frontend.Parse())
+
+	errors := reporter.Errors()
+	if len(errors) != 1 || errors[0].Message != "Expected 1 arguments but got 0." {
+		t.Errorf("unexpected errors %v", errors)
+	}
+}
+
+func TestReturnValueFromInitializer(t *testing.T) {
+	reporter := CollectingErrorReporter{}
+	frontend := NewFrontend([]byte("class A { init() { fun f() { return 1; } return 2; } }"), &reporter)
+	frontend.Parse()
+
+	errors := reporter.Errors()
+	if len(errors) != 1 || errors[0].Message != "Can't return a value from an initializer." {
+		t.Errorf("unexpected errors %v", errors)
+	}
+}
+
+func TestInheritance(t *testing.T) {
+	interpreter := interpret(t, `
+class Animal {
+	init(name) {
+		this.name = name;
+	}
+	describe() {
+		return this.name + " makes " + this.sound();
+	}
+	sound() {
+		return "a sound";
+	}
+}
+class Dog < Animal {
+	sound() {
+		return "woof";
+	}
+	describe() {
+		return super.describe() + "!";
+	}
+}
+var inherited = Dog("Rex").name;
+var overridden = Dog("Rex").sound();
+var described = Dog("Rex").describe();
+`)
+
+	if inherited := global(t, interpreter, "inherited"); inherited != "Rex" {
+		t.Errorf("expected init to be inherited, got %v", inherited)
+	}
+	if overridden := global(t, interpreter, "overridden"); overridden != "woof" {
+		t.Errorf("expected sound to be overridden, got %v", overridden)
+	}
+	if described := global(t, interpreter, "described"); described != "Rex makes woof!" {
+		t.Errorf("expected super to call the parent's describe on the instance, got %v", described)
+	}
+}
+
+func TestInheritanceErrors(t *testing.T) {
+	reporter := CollectingErrorReporter{}
+	frontend := NewFrontend([]byte("class A < A {} class B { f() { super.f(); } } super.g;"), &reporter)
+	frontend.Parse()
+
+	errors := reporter.Errors()
+	expected := []string{
+		"A class can't inherit from itself.",
+		"Can't use 'super' in a class with no superclass.",
+		"Can't use 'super' outside of a class.",
+	}
+	if len(errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errors)
+	}
+	for i, message := range expected {
+		if errors[i].Message != message {
+			t.Errorf("expected %q, got %v", message, errors[i])
+		}
+	}
+
+	reporter = CollectingErrorReporter{}
+	frontend = NewFrontend([]byte("var NotAClass = 1; class A < NotAClass {}"), &reporter)
+	interpreter := NewInterpreter(&reporter, nil)
+	interpreter.Execute(frontend.Parse())
+
+	errors = reporter.Errors()
+	if len(errors) != 1 || errors[0].Message != "Superclass must be a class." {
+		t.Errorf("unexpected errors %v", errors)
+	}
+}
+
+func TestLambda(t *testing.T) {
+	interpreter := interpret(t, `
+var offset = 10;
+var add = fun (a, b) { return a + b + offset; };
+var sum = add(1, 2);
+
+fun twice(f, x) {
+	return f(f(x));
+}
+var doubled = twice(fun (n) { return n * 2; }, 3);
+`)
+
+	if sum := global(t, interpreter, "sum"); sum != int64(13) {
+		t.Errorf("expected the lambda to capture offset, got %v", sum)
+	}
+	if doubled := global(t, interpreter, "doubled"); doubled != int64(12) {
+		t.Errorf("expected 12, got %v", doubled)
+	}
+	if s := stringify(global(t, interpreter, "add")); s != "<fn>" {
+		t.Errorf("unexpected string %q", s)
+	}
+}
+
+func TestClosureCapture(t *testing.T) {
+	interpreter := interpret(t, `
+var a = "global";
+var first;
+var second;
+{
+	fun showA() {
+		return a;
+	}
+	first = showA();
+	var a = "block";
+	second = showA();
+}
+`)
+
+	if first := global(t, interpreter, "first"); first != "global" {
+		t.Errorf("expected the closure to read the global a, got %v", first)
+	}
+	if second := global(t, interpreter, "second"); second != "global" {
+		t.Errorf("expected the closure to keep reading the global a, got %v", second)
+	}
+}
+
+func TestClosuresInLoop(t *testing.T) {
+	interpreter := interpret(t, `
+var closures = [nil, nil];
+for (var i = 0; i < 2; i = i + 1) {
+	var j = i;
+	closures[i] = fun () { return j; };
+}
+var first = closures[0]();
+var second = closures[1]();
+`)
+
+	if first := global(t, interpreter, "first"); first != int64(0) {
+		t.Errorf("expected the first closure to keep its own j, got %v", first)
+	}
+	if second := global(t, interpreter, "second"); second != int64(1) {
+		t.Errorf("expected the second closure to keep its own j, got %v", second)
+	}
+}
+
+func TestOwnInitializer(t *testing.T) {
+	reporter := CollectingErrorReporter{}
+	frontend := NewFrontend([]byte("{ var a = a; }"), &reporter)
+	interpreter := NewInterpreter(&reporter, nil)
+	resolver := NewResolver(&interpreter, &reporter)
+	if e := resolver.Resolve(frontend.Parse()); e == nil {
+		t.Error("expected a resolve error")
+	}
+	errors := reporter.Errors()
+	if len(errors) != 1 || errors[0].Message != "Can't read local variable in its own initializer." {
+		t.Errorf("unexpected errors %v", errors)
+	}
+
+	shadowing := interpret(t, `
+var a = 1;
+var inner;
+{
+	var a = a + 1;
+	inner = a;
+}
+`)
+	if inner := global(t, shadowing, "inner"); inner != int64(2) {
+		t.Errorf("expected the initializer to read the outer a, got %v", inner)
+	}
+}
+
+func TestUnreachableCode(t *testing.T) {
+	tests := []struct {
+		source   string
+		warnings []string
+	}{
+		{"fun f() { return 1; print 2; return 3; }", []string{"[line 1] Unreachable code after 'return'."}},
+		{"while (true) { break; print 1; }", []string{"[line 1] Unreachable code after 'break'."}},
+		{"fun f(x) { if (x) return 1; else return 2; print 3; }", nil},
+		{"fun f(x) { if (x) { return 1; } print 2; }", nil},
+		{"fun f() { print 1; return; }", nil},
+	}
+	for _, test := range tests {
+		reporter := CollectingErrorReporter{}
+		frontend := NewFrontend([]byte(test.source), &reporter)
+		interpreter := NewInterpreter(&reporter, nil)
+		resolver := NewResolver(&interpreter, &reporter)
+		if e := resolver.Resolve(frontend.Parse()); e != nil {
+			t.Fatalf("unexpected errors for %q: %v", test.source, reporter.Errors())
+		}
+
+		warnings := reporter.Warnings()
+		if len(warnings) != len(test.warnings) {
+			t.Errorf("expected warnings %v for %q, got %v", test.warnings, test.source, warnings)
+			continue
+		}
+		for i := range warnings {
+			if warnings[i] != test.warnings[i] {
+				t.Errorf("expected warnings %v for %q, got %v", test.warnings, test.source, warnings)
+			}
+		}
+	}
+}
+
+func TestUnusedLocals(t *testing.T) {
+	tests := []struct {
+		source     string
+		warnUnused bool
+		warnings   []string
+	}{
+		{"{ var a = 1; print a; }", true, nil},
+		{"fun f() { var a = 1; fun g() { return a; } return g; }", true, nil},
+		{"{ var a = 1;\nvar b = 2; b = 3; }", true, []string{
+			"[line 1] Local variable 'a' is never used.",
+			"[line 2] Local variable 'b' is never used.",
+		}},
+		{"{ var a = 1; }", false, nil},
+		{"var global = 1;", true, nil},
+	}
+	for _, test := range tests {
+		reporter := CollectingErrorReporter{}
+		frontend := NewFrontend([]byte(test.source), &reporter)
+		interpreter := NewInterpreter(&reporter, nil)
+		resolver := NewResolver(&interpreter, &reporter)
+		resolver.WarnUnused = test.warnUnused
+		if e := resolver.Resolve(frontend.Parse()); e != nil {
+			t.Fatalf("unexpected errors for %q: %v", test.source, reporter.Errors())
+		}
+
+		warnings := reporter.Warnings()
+		if len(warnings) != len(test.warnings) {
+			t.Errorf("expected warnings %v for %q, got %v", test.warnings, test.source, warnings)
+			continue
+		}
+		for i := range warnings {
+			if warnings[i] != test.warnings[i] {
+				t.Errorf("expected warnings %v for %q, got %v", test.warnings, test.source, warnings)
+			}
+		}
+	}
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := map[string]int64{
+		"6 & 3":         2,
+		"4 | 1":         5,
+		"5 ^ 1":         4,
+		"~5":            -6,
+		"1 | 2 & 3":     3,
+		"2 | 1 + 1":     2,
+		"-8 & 0xF":      8,
+		"0b1010 ^ 0b11": 9,
+		// Integers are exact beyond 2^53, and so are floats up to 2^53.
+		"9007199254740993 & 1":   1,
+		"9007199254740992.0 | 1": 9007199254740993,
+	}
+	for source, expected := range tests {
+		if e, value := evaluate(t, source); e != nil || value != expected {
+			t.Errorf("expected %s to be %v, got %v (error: %v)", source, expected, value, e)
+		}
+	}
+
+	for _, source := range []string{"1.5 & 1", "1 | 0.5", "~0.1", `"a" ^ 1`} {
+		if e, _ := evaluate(t, source); e == nil {
+			t.Errorf("expected a runtime error for %s", source)
+		}
+	}
+	if e, _ := evaluate(t, "1.5 & 1"); e.Error() != "Operands of bitwise operators must be whole numbers." {
+		t.Errorf("unexpected error %v", e)
+	}
+
+	// Floats beyond 2^53 may not be the intended integer, or not fit in an integer at all.
+	for _, source := range []string{"9007199254740994.0 & 1", "~(2 ** 70)", "1 | -(2 ** 64)", "2 ** 63 div 1"} {
+		if e, _ := evaluate(t, source); e == nil || !strings.HasSuffix(e.Error(), " must be integers or floating point numbers within ±2^53.") {
+			t.Errorf("expected an out of range error for %s, got %v", source, e)
+		}
+	}
+}
+
+func TestExponentiation(t *testing.T) {
+	tests := map[string]interface{}{
+		"2 ** 3 ** 2": int64(512),
+		"2 ** 10":     int64(1024),
+		"-2 ** 2":     int64(-4),
+		"(-2) ** 3":   int64(-8),
+		"(-2) ** 63":  int64(-9223372036854775808),
+		"3 ** 39":     int64(4052555153018976267),
+		"2 ** -1":     0.5,
+		"2 * 3 ** 2":  int64(18),
+		"0 ** 0":      int64(1),
+		"4 ** 0.5":    2.0,
+		"2.0 ** 3":    8.0,
+		"2 ** 63":     9223372036854775808.0,
+		"3 ** 40":     12157665459056928801.0,
+		"(-2) ** 65":  -36893488147419103232.0,
+		"10 ** 19":    1e19,
+	}
+	for source, expected := range tests {
+		if e, value := evaluate(t, source); e != nil || value != expected {
+			t.Errorf("expected %s to be %v, got %v (error: %v)", source, expected, value, e)
+		}
+	}
+
+	if e, _ := evaluate(t, "(-8) ** 0.5"); e == nil || e.Error() != "Result of exponentiation is not a real number." {
+		t.Errorf("expected a runtime error for a negative base with a fractional exponent, got %v", e)
+	}
+}
+
+func TestCommaOperator(t *testing.T) {
+	call, isCall := parseExpression(t, "f(1, 2)").(Call)
+	if !isCall || len(call.Arguments) != 2 {
+		t.Errorf("expected a call with 2 arguments, got %v", (AstPrinter{}).PrintExpr(call))
+	}
+
+	if e, value := evaluate(t, "(1, 2, 3)"); e != nil || value != int64(3) {
+		t.Errorf("expected (1, 2, 3) to be 3, got %v (error: %v)", value, e)
+	}
+
+	interpreter := interpret(t, `
+var a = 0;
+var b = (a = 1, a + 1);
+fun pair(x, y) { return [x, y]; }
+var args = pair((a, b), 3);
+`)
+	if b := global(t, interpreter, "b"); b != int64(2) {
+		t.Errorf("expected the left operand to be evaluated first, got %v", b)
+	}
+	if args := stringify(global(t, interpreter, "args")); args != "[2, 3]" {
+		t.Errorf("expected a grouped comma expression to be a single argument, got %s", args)
+	}
+}
+
+func TestStringNatives(t *testing.T) {
+	tests := map[string]string{
+		`upper("héllo")`:                       "HÉLLO",
+		`lower("HeLLo")`:                       "hello",
+		`trim("  a b \t\n")`:                   "a b",
+		`upper(trim(" a ")) + lower(" B")`:     "A b",
+		`"<" + trim(upper(" x ") + " ") + ">"`: "<X>",
+	}
+	for source, expected := range tests {
+		if e, value := evaluate(t, source); e != nil || value != expected {
+			t.Errorf("expected %s to be %q, got %v (error: %v)", source, expected, value, e)
+		}
+	}
+
+	for _, name := range []string{"upper", "lower", "trim"} {
+		e, _ := evaluate(t, name+"(1)")
+		if e == nil || e.Error() != name+" expects a string." {
+			t.Errorf("expected a runtime error for %s(1), got %v", name, e)
+		}
+	}
+}
+
+func TestNumberConversionNatives(t *testing.T) {
+	tests := map[string]interface{}{
+		`number("3.14")`:            3.14,
+		`number("-2") + 1`:          int64(-1),
+		`str(42)`:                   "42",
+		`str(0.5)`:                  "0.5",
+		`str(nil)`:                  "nil",
+		`str([1, "a"])`:             "[1, a]",
+		`"n = " + str(number("7"))`: "n = 7",
+	}
+	for source, expected := range tests {
+		if e, value := evaluate(t, source); e != nil || value != expected {
+			t.Errorf("expected %s to be %v, got %v (error: %v)", source, expected, value, e)
+		}
+	}
+
+	errors := map[string]string{
+		`number("abc")`: "Can't parse 'abc' as a number.",
+		`number("")`:    "Can't parse '' as a number.",
+		`number("inf")`: "Can't parse 'inf' as a number.",
+		`number(1)`:     "number expects a string.",
+	}
+	for source, expected := range errors {
+		if e, _ := evaluate(t, source); e == nil || e.Error() != expected {
+			t.Errorf("expected error %q for %s, got %v", expected, source, e)
+		}
+	}
+}
+
+func TestMathNatives(t *testing.T) {
+	tests := map[string]interface{}{
+		`sqrt(16)`:    4.0,
+		`sqrt(0)`:     0.0,
+		`floor(2.7)`:  2.0,
+		`floor(-2.5)`: -3.0,
+		`ceil(2.1)`:   3.0,
+		`ceil(-2.5)`:  -2.0,
+		`abs(-3)`:     3.0,
+		`abs(4)`:      4.0,
+		`min(1, 2)`:   1.0,
+		`min(-1, -2)`: -2.0,
+		`max(1, 2)`:   2.0,
+		`max(3, 3)`:   3.0,
+	}
+	for source, expected := range tests {
+		if e, value := evaluate(t, source); e != nil || value != expected {
+			t.Errorf("expected %s to be %v, got %v (error: %v)", source, expected, value, e)
+		}
+	}
+
+	errors := map[string]string{
+		`sqrt(-1)`:     "sqrt expects a non-negative number.",
+		`sqrt("4")`:    "sqrt expects a number.",
+		`floor(nil)`:   "floor expects a number.",
+		`ceil(true)`:   "ceil expects a number.",
+		`abs("x")`:     "abs expects a number.",
+		`min(1, "2")`:  "min expects two numbers.",
+		`max("1", 2)`:  "max expects two numbers.",
+		`min(1)`:       "Expected 2 arguments but got 1.",
+		`max(1, 2, 3)`: "Expected 2 arguments but got 3.",
+	}
+	for source, expected := range errors {
+		if e, _ := evaluate(t, source); e == nil || e.Error() != expected {
+			t.Errorf("expected error %q for %s, got %v", expected, source, e)
+		}
+	}
+}
+
+func TestInput(t *testing.T) {
+	reporter := StateErrorReporter{}
+	frontend := NewFrontend([]byte(`
+var name = input("Name? ");
+var age = input("Age? ");
+var missing = input("More? ");
+print name + " is " + age;`), &reporter)
+	statements := frontend.Parse()
+
+	out := bytes.Buffer{}
+	interpreter := NewInterpreter(&reporter, &out)
+	interpreter.SetInput(strings.NewReader("Ada\r\n36"))
+	interpreter.Execute(statements)
+	if reporter.HadError || reporter.HadRuntimeError {
+		t.Fatal("unexpected error")
+	}
+	if printed := out.String(); printed != "Name? Age? More? Ada is 36\n" {
+		t.Errorf("unexpected output %q", printed)
+	}
+	if missing := global(t, &interpreter, "missing"); missing != nil {
+		t.Errorf("expected nil at the end of the input, got %v", missing)
+	}
+}
+
+func TestIntegers(t *testing.T) {
+	tests := map[string]interface{}{
+		"2 * 3":               int64(6),
+		"7 - 10":              int64(-3),
+		"-(1 + 1)":            int64(-2),
+		"0xFF + 0b1":          int64(256),
+		"5 / 2":               2.5,
+		"6 / 3":               2.0,
+		"1 + 0.5":             1.5,
+		"2 * 1.5":             3.0,
+		"2.0 * 3":             6.0,
+		"9223372036854775807": int64(9223372036854775807),
+		"9223372036854775808": 9223372036854775808.0,
+		"1 == 1.0":            true,
+		"2 < 2.5":             true,
+		`{1: "a"}[1.0]`:       "a",
+		`[1, 2][6 / 3 - 1]`:   int64(2),
+		`len("abc") * 2`:      int64(6),
+		`number("12") + 1`:    int64(13),
+		`number("1.5") + 1`:   2.5,
+		// Integer arithmetic that overflows is done in floating point.
+		"9223372036854775807 + 1":         9223372036854775808.0,
+		"-9223372036854775807 - 2":        -9223372036854775809.0,
+		"4611686018427387904 * 2":         9223372036854775808.0,
+		"-4611686018427387904 * 2":        int64(-9223372036854775808),
+		"-(-9223372036854775807 - 1) - 1": 9223372036854775807.0,
+		"(-9223372036854775807 - 1) * -1": 9223372036854775808.0,
+		"9223372036854775807 - 1":         int64(9223372036854775806),
+	}
+	for source, expected := range tests {
+		if e, value := evaluate(t, source); e != nil || value != expected {
+			t.Errorf("expected %s to be %#v, got %#v (error: %v)", source, expected, value, e)
+		}
+	}
+}
+
+func TestIntegerDivision(t *testing.T) {
+	tests := map[string]int64{
+		"7 div 2":      3,
+		"-7 div 2":     -3,
+		"7 div -2":     -3,
+		"6 div 3":      2,
+		"6.0 div 4":    1,
+		"1 + 7 div 2":  4,
+		"2 * 7 div 2":  7,
+		"7 div 2 ** 2": 1,
+	}
+	for source, expected := range tests {
+		if e, value := evaluate(t, source); e != nil || value != expected {
+			t.Errorf("expected %s to be %v, got %#v (error: %v)", source, expected, value, e)
+		}
+	}
+
+	errors := map[string]string{
+		"5 div 0":   "Division by zero.",
+		"5 div 0.0": "Division by zero.",
+		"5.5 div 2": "Operands of integer division must be whole numbers.",
+		`"a" div 2`: "operand must be a number.",
+	}
+	for source, expected := range errors {
+		if e, _ := evaluate(t, source); e == nil || e.Error() != expected {
+			t.Errorf("expected error %q for %s, got %v", expected, source, e)
+		}
+	}
+}
+
+// Literals and values computed at runtime or stored in variables have the same
+// representation, so they can be mixed freely.
+func TestLiteralAndVariableOperands(t *testing.T) {
+	interpreter := interpret(t, `
+var one = 1;
+var half = 0.5;
+var a = "a";
+var yes = true;
+var sum = one + 1;
+var mixed = half + 1;
+var repeated = a * 2;
+var joined = a + "b";
+var sameInteger = one == 1;
+var sameFloat = half == 0.5;
+var wholeFloat = 1.0 == one;
+var sameString = a == "a";
+var sameBool = yes == true;
+var key = {"a": 1}[a];
+var found = [1, 2][one];
+`)
+
+	tests := map[string]interface{}{
+		"sum":         int64(2),
+		"mixed":       1.5,
+		"repeated":    "aa",
+		"joined":      "ab",
+		"sameInteger": true,
+		"sameFloat":   true,
+		"wholeFloat":  true,
+		"sameString":  true,
+		"sameBool":    true,
+		"key":         int64(1),
+		"found":       int64(2),
+	}
+	for name, expected := range tests {
+		if value := global(t, interpreter, name); value != expected {
+			t.Errorf("expected %s to be %#v, got %#v", name, expected, value)
+		}
+	}
+}
+
+func TestNullCoalescing(t *testing.T) {
+	tests := map[string]interface{}{
+		"nil ?? 5":        int64(5),
+		"3 ?? 5":          int64(3),
+		"false ?? 5":      false,
+		"nil ?? nil ?? 7": int64(7),
+		"nil ?? nil":      nil,
+	}
+	for source, expected := range tests {
+		if e, value := evaluate(t, source); e != nil || value != expected {
+			t.Errorf("expected %s to be %#v, got %#v (error: %v)", source, expected, value, e)
+		}
+	}
+
+	interpreter := interpret(t, `
+var calls = 0;
+fun fallback() {
+	calls = calls + 1;
+	return "fallback";
+}
+var kept = "value" ?? fallback();
+var replaced = nil ?? fallback();
+`)
+	if kept := global(t, interpreter, "kept"); kept != "value" {
+		t.Errorf("expected the left operand, got %v", kept)
+	}
+	if replaced := global(t, interpreter, "replaced"); replaced != "fallback" {
+		t.Errorf("expected the right operand, got %v", replaced)
+	}
+	if calls := global(t, interpreter, "calls"); calls != int64(1) {
+		t.Errorf("expected the right operand to only be evaluated when the left is nil, got %v calls", calls)
+	}
+}
+
+func TestTernary(t *testing.T) {
+	interpreter := interpret(t, `
+var calls = "";
+fun call(name) {
+	calls = calls + name;
+	return name;
+}
+var taken = true ? call("a") : call("b");
+var notTaken = false ? call("c") : call("d");
+var nilCondition = nil ? "a" : "b";
+var zeroCondition = 0 ? "a" : "b";
+`)
+
+	tests := map[string]interface{}{
+		"taken":         "a",
+		"notTaken":      "d",
+		"calls":         "ad",
+		"nilCondition":  "b",
+		"zeroCondition": "a",
+	}
+	for name, expected := range tests {
+		if value := global(t, interpreter, name); value != expected {
+			t.Errorf("expected %s to be %#v, got %#v", name, expected, value)
+		}
+	}
+}
+
+func TestMultipleVarDeclarations(t *testing.T) {
+	interpreter := interpret(t, `
+var a = 1, b = a + 1, c;
+var d = (a, b);
+var sum = 0;
+for (var i = 0, j = 3; i < j; i = i + 1) {
+	sum = sum + i;
+}
+`)
+
+	tests := map[string]interface{}{
+		"a":   int64(1),
+		"b":   int64(2),
+		"c":   nil,
+		"d":   int64(2),
+		"sum": int64(3),
+	}
+	for name, expected := range tests {
+		if value := global(t, interpreter, name); value != expected {
+			t.Errorf("expected %s to be %#v, got %#v", name, expected, value)
+		}
+	}
+}
+
+func TestDoWhile(t *testing.T) {
+	interpreter := interpret(t, `
+var once = 0;
+do {
+	once = once + 1;
+} while (false);
+
+var sum = 0;
+var i = 0;
+do {
+	i = i + 1;
+	if (i == 2) continue;
+	if (i > 4) break;
+	sum = sum + i;
+} while (i < 10);
+`)
+
+	if once := global(t, interpreter, "once"); once != int64(1) {
+		t.Errorf("expected the body to run once, got %v", once)
+	}
+	if sum := global(t, interpreter, "sum"); sum != int64(1+3+4) {
+		t.Errorf("expected 8, got %v", sum)
+	}
+	if i := global(t, interpreter, "i"); i != int64(5) {
+		t.Errorf("expected the loop to break at 5, got %v", i)
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	interpreter := interpret(t, `
+fun classify(n) {
+	var result = "";
+	switch (n) {
+	case 1:
+		result = result + "one";
+	case 1.0 + 1:
+		result = result + "two";
+	case "three":
+		result = result + "three";
+	default:
+		result = result + "other";
+	}
+	return result;
+}
+var matched = classify(1);
+var equalNumbers = classify(2);
+var fallback = classify(4);
+var string = classify("three");
+
+var evaluated = 0;
+fun count(value) {
+	evaluated = evaluated + 1;
+	return value;
+}
+var noDefault = "unchanged";
+switch (count(1)) {
+case count(2):
+	noDefault = "two";
+case count(3):
+	noDefault = "three";
+}
+`)
+
+	tests := map[string]interface{}{
+		"matched":      "one",
+		"equalNumbers": "two",
+		"fallback":     "other",
+		"string":       "three",
+		"noDefault":    "unchanged",
+		"evaluated":    int64(3),
+	}
+	for name, expected := range tests {
+		if value := global(t, interpreter, name); value != expected {
+			t.Errorf("expected %s to be %#v, got %#v", name, expected, value)
+		}
+	}
+
+	reporter := CollectingErrorReporter{}
+	frontend := NewFrontend([]byte("switch (1) { default: print 1; default: print 2; }"), &reporter)
+	frontend.Parse()
+	errors := reporter.Errors()
+	if len(errors) != 1 || errors[0].Message != "Can't have more than one default in a switch." {
+		t.Errorf("unexpected errors %v", errors)
+	}
+}
+
+// Every runtime error must be reported at the operator, call, etc. that caused it.
+func TestRuntimeErrorPositions(t *testing.T) {
+	tests := map[string]string{
+		`"a" + 1;`:          "operand must be string",
+		`nil + 1;`:          "expected two strings or two numbers but got <nil> + 1",
+		`1 / 0;`:            "Division by zero.",
+		`1 div 0;`:          "Division by zero.",
+		`1.5 div 1;`:        "Operands of integer division must be whole numbers.",
+		`(-8) ** 0.5;`:      "Result of exponentiation is not a real number.",
+		`-"a";`:             "operand must be a number.",
+		`1 < "a";`:          "operand must be a number.",
+		`1.5 & 1;`:          "Operands of bitwise operators must be whole numbers.",
+		`"a" * -1;`:         "String repetition count must be a non-negative whole number.",
+		`"a"();`:            "Can only call functions and classes.",
+		`clock(1);`:         "Expected 0 arguments but got 1.",
+		`len(1);`:           "len expects a string, list or map.",
+		`x;`:                "Undefined variable 'x'.",
+		`x = 1;`:            "Undefined variable 'x'.",
+		`[1][1];`:           "Index out of range.",
+		`[1]["a"];`:         "Index must be a whole number.",
+		`({"a": 1})["b"];`:  "Undefined key b.",
+		`({"a": 1})[[1]];`:  "Map keys must be strings, numbers or booleans but got [1].",
+		`1[0];`:             "Only strings, lists and maps can be indexed.",
+		`"a"[0] = "b";`:     "Only list and map elements can be assigned to.",
+		`true.x;`:           "Only instances have properties.",
+		`true.x = 1;`:       "Only instances have fields.",
+		`A().x;`:            "Undefined property 'x'.",
+		`B().m();`:          "Undefined property 'x'.",
+		`class C < one {}`:  "Superclass must be a class.",
+		`true ? 1 / 0 : 1;`: "Division by zero.",
+		`nil ? 1 : -"a";`:   "operand must be a number.",
+	}
+	for source, expected := range tests {
+		// The code that fails is on the third line.
+		code := "class A {}\nclass B < A { m() { super.x(); } } var one = 1;\n" + source
+		reporter := CollectingErrorReporter{}
+		frontend := NewFrontend([]byte(code), &reporter)
+		statements := frontend.Parse()
+		interpreter := NewInterpreter(&reporter, nil)
+		resolver := NewResolver(&interpreter, &reporter)
+		if e := resolver.Resolve(statements); e != nil {
+			t.Fatalf("unexpected errors in %s: %v", source, reporter.Errors())
+		}
+		interpreter.Execute(statements)
+
+		errors := reporter.Errors()
+		if len(errors) != 1 || errors[0].Message != expected {
+			t.Errorf("expected error %q for %s, got %v", expected, source, errors)
+		} else if line := errors[0].Line; line != 3 && !(source == `B().m();` && line == 2) {
+			t.Errorf("expected the error for %s to be reported on line 3, got line %d", source, line)
+		} else if errors[0].Column == 0 {
+			t.Errorf("expected the error for %s to have a column", source)
+		}
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	tests := map[string]string{
+		`"Hello, ${"world"}!"`:         "Hello, world!",
+		`"${1 + 2 * 3} items"`:         "7 items",
+		`"\${a}"`:                      "${a}",
+		`"${"a" + "${"b"}"}c"`:         "abc",
+		`"${ {"k": 0.5}["k"] }"`:       "0.5",
+		`"${nil}, ${true}, ${[1, 2]}"`: "nil, true, [1, 2]",
+	}
+	for source, expected := range tests {
+		if e, value := evaluate(t, source); e != nil || value != expected {
+			t.Errorf("expected %s to evaluate to %q, got %v (%v)", source, expected, value, e)
+		}
+	}
+
+	interpreter := interpret(t, `var name = "Lox"; var greeting = "Hello, ${name}!";`)
+	if greeting := global(t, interpreter, "greeting"); greeting != "Hello, Lox!" {
+		t.Errorf("unexpected greeting %v", greeting)
+	}
+}
@@ -0,0 +1,82 @@
+package internal
+
+// LoxCallable is implemented by every Lox value that can be called, e.g. functions.
+type LoxCallable interface {
+	// Arity is the number of arguments the callable expects.
+	Arity() int
+	Call(interpreter *Interpreter, arguments []interface{}) (error, interface{})
+}
+
+// LoxFunction is the runtime representation of a function declared in Lox code.
+type LoxFunction struct {
+	declaration Function
+	closure     *Environment // The environment the function was declared in
+	// Whether the function is the init method of a class, which always returns the instance
+	isInitializer bool
+}
+
+func (function LoxFunction) Arity() int {
+	return len(function.declaration.Params)
+}
+
+// Call executes the function body in a new environment, enclosed by the closure, in which
+// the parameters are bound to the arguments.
+func (function LoxFunction) Call(interpreter *Interpreter, arguments []interface{}) (e error, result interface{}) {
+	// A return statement unwinds the stack up to here.
+	defer func() {
+		if r := recover(); r != nil {
+			returned, isReturn := r.(returnValue)
+			if !isReturn {
+				panic(r)
+			}
+			e = nil
+			result = returned.Value
+			if function.isInitializer {
+				result = function.this()
+			}
+		}
+	}()
+
+	environment := NewEnvironment(function.closure)
+	for i, param := range function.declaration.Params {
+		environment.Define(param.Lexeme, arguments[i])
+	}
+
+	if e, _ := interpreter.executeBlock(function.declaration.Body, environment); e != nil {
+		return e, nil
+	}
+	if function.isInitializer {
+		return nil, function.this()
+	}
+	return nil, nil
+}
+
+// this returns the instance a method is bound to.
+func (function LoxFunction) this() interface{} {
+	_, instance := function.closure.Get(Token{Type: TokenThis, Lexeme: "this"})
+	return instance
+}
+
+// bind returns a copy of the method in which `this` refers to the instance.
+func (function LoxFunction) bind(instance *LoxInstance) *LoxFunction {
+	environment := NewEnvironment(function.closure)
+	environment.Define("this", instance)
+	return &LoxFunction{
+		declaration:   function.declaration,
+		closure:       environment,
+		isInitializer: function.isInitializer,
+	}
+}
+
+func (function LoxFunction) String() string {
+	// Lambdas have no name, the fun keyword is used in its place.
+	if function.declaration.Name.Type == TokenFun {
+		return "<fn>"
+	}
+	return "<fn " + function.declaration.Name.Lexeme + ">"
+}
+
+// Sentinel used to unwind the interpreter from a return statement to the function call.
+type returnValue struct {
+	Value interface{}
+}
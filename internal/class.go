@@ -0,0 +1,78 @@
+package internal
+
+import "fmt"
+
+// LoxClass is the runtime representation of a class declared in Lox code. Calling a class
+// creates a new instance of it.
+type LoxClass struct {
+	Name       string
+	superclass *LoxClass // nil if the class doesn't inherit from another class
+	methods    map[string]*LoxFunction
+}
+
+// findMethod looks up the method in the class and, if it isn't found, its superclasses.
+func (class *LoxClass) findMethod(name string) (*LoxFunction, bool) {
+	if method, found := class.methods[name]; found {
+		return method, true
+	}
+	if class.superclass != nil {
+		return class.superclass.findMethod(name)
+	}
+	return nil, false
+}
+
+// Arity is the arity of the initializer, if the class has one.
+func (class *LoxClass) Arity() int {
+	if initializer, found := class.findMethod("init"); found {
+		return initializer.Arity()
+	}
+	return 0
+}
+
+// Call creates a new instance and runs the initializer, if any, with the arguments.
+func (class *LoxClass) Call(interpreter *Interpreter, arguments []interface{}) (error, interface{}) {
+	instance := &LoxInstance{
+		class:  class,
+		fields: make(map[string]interface{}),
+	}
+	if initializer, found := class.findMethod("init"); found {
+		if e, _ := initializer.bind(instance).Call(interpreter, arguments); e != nil {
+			return e, nil
+		}
+	}
+	return nil, instance
+}
+
+func (class *LoxClass) String() string {
+	return class.Name
+}
+
+// LoxInstance is the runtime representation of an instance of a class. Instances are shared
+// by reference, so they are always used as a pointer.
+type LoxInstance struct {
+	class  *LoxClass
+	fields map[string]interface{}
+}
+
+// Get returns the value of the property. Fields shadow methods; a method is bound to the
+// instance so that `this` refers to it when the method is called.
+func (instance *LoxInstance) Get(name Token) (error, interface{}) {
+	if value, found := instance.fields[name.Lexeme]; found {
+		return nil, value
+	}
+	if method, found := instance.class.findMethod(name.Lexeme); found {
+		return nil, method.bind(instance)
+	}
+	return RuntimeError{
+		Token: name,
+		Msg:   fmt.Sprintf("Undefined property '%s'.", name.Lexeme),
+	}, nil
+}
+
+func (instance *LoxInstance) Set(name Token, value interface{}) {
+	instance.fields[name.Lexeme] = value
+}
+
+func (instance *LoxInstance) String() string {
+	return instance.class.Name + " instance"
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LoxList is the runtime representation of a Lox list. Lists are mutable and shared by
+// reference, so they are always used as a pointer.
+type LoxList struct {
+	Elements []interface{}
+}
+
+func (list *LoxList) String() string {
+	return list.format(ShortestDecimals, nil)
+}
+
+// format prints the list with floating point numbers printed with the number of decimals.
+// The list is printed as [...] if it is already being printed, see formatNested.
+func (list *LoxList) format(decimals int, printing map[interface{}]bool) string {
+	if printing[list] {
+		return "[...]"
+	}
+	if printing == nil {
+		printing = make(map[interface{}]bool)
+	}
+	printing[list] = true
+	defer delete(printing, list)
+
+	elements := make([]string, len(list.Elements))
+	for i, element := range list.Elements {
+		elements[i] = formatNested(element, decimals, printing)
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// index converts the Lox value to a position in a sequence of the given length.
+func index(bracket Token, value interface{}, length int) (error, int) {
+	i, isInteger := normalize(value).(int64)
+	if !isInteger {
+		return RuntimeError{
+			Token: bracket,
+			Msg:   "Index must be a whole number.",
+		}, 0
+	}
+	if i < 0 || i >= int64(length) {
+		return RuntimeError{
+			Token: bracket,
+			Msg:   "Index out of range.",
+		}, 0
+	}
+	return nil, int(i)
+}
+
+// LoxMap is the runtime representation of a Lox map. Like lists, maps are mutable and
+// always used as a pointer. Entries are kept in insertion order.
+type LoxMap struct {
+	entries map[interface{}]interface{}
+	keys    []interface{}
+}
+
+func NewLoxMap() *LoxMap {
+	return &LoxMap{
+		entries: make(map[interface{}]interface{}),
+	}
+}
+
+// Get returns the value of the key and whether the key is in the map.
+func (m *LoxMap) Get(key interface{}) (interface{}, bool) {
+	value, found := m.entries[normalize(key)]
+	return value, found
+}
+
+// Set adds or replaces the entry of the key. The key must be hashable, see isHashable.
+func (m *LoxMap) Set(key interface{}, value interface{}) {
+	key = normalize(key)
+	if _, found := m.entries[key]; !found {
+		m.keys = append(m.keys, key)
+	}
+	m.entries[key] = value
+}
+
+// Len returns the number of entries.
+func (m *LoxMap) Len() int {
+	return len(m.keys)
+}
+
+func (m *LoxMap) String() string {
+	return m.format(ShortestDecimals, nil)
+}
+
+// format prints the map with floating point numbers printed with the number of decimals.
+// The map is printed as {...} if it is already being printed, see formatNested.
+func (m *LoxMap) format(decimals int, printing map[interface{}]bool) string {
+	if printing[m] {
+		return "{...}"
+	}
+	if printing == nil {
+		printing = make(map[interface{}]bool)
+	}
+	printing[m] = true
+	defer delete(printing, m)
+
+	entries := make([]string, len(m.keys))
+	for i, key := range m.keys {
+		entries[i] = format(key, decimals) + ": " + formatNested(m.entries[key], decimals, printing)
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+// isHashable reports whether the value can be used as a map key. Only values that are
+// compared by value can be used, i.e. strings, numbers and booleans.
+func isHashable(value interface{}) bool {
+	switch value.(type) {
+	case string, int64, float64, bool:
+		return true
+	default:
+		return false
+	}
+}
+
+// mapKey checks that the Lox value can be used as a map key.
+func mapKey(bracket Token, key interface{}) error {
+	if !isHashable(key) {
+		return RuntimeError{
+			Token: bracket,
+			Msg:   fmt.Sprintf("Map keys must be strings, numbers or booleans but got %s.", stringify(key)),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// OpCode is a bytecode instruction of the VM. Some instructions are followed by operands.
+type OpCode byte
+
+const (
+	OpConstant OpCode = iota // Push the constant at the 2-byte index that follows
+	OpNil
+	OpTrue
+	OpFalse
+	OpPop // Pop a value and discard it
+	OpEqual
+	OpNotEqual
+	OpGreater
+	OpGreaterEqual
+	OpLess
+	OpLessEqual
+	OpAdd
+	OpSubtract
+	OpMultiply
+	OpDivide
+	OpNot
+	OpNegate
+	OpPrint  // Pop the number of values given by the 1-byte operand and print them
+	OpReturn // End the chunk
+)
+
+var opCodeNames = [...]string{
+	OpConstant:     "CONSTANT",
+	OpNil:          "NIL",
+	OpTrue:         "TRUE",
+	OpFalse:        "FALSE",
+	OpPop:          "POP",
+	OpEqual:        "EQUAL",
+	OpNotEqual:     "NOT_EQUAL",
+	OpGreater:      "GREATER",
+	OpGreaterEqual: "GREATER_EQUAL",
+	OpLess:         "LESS",
+	OpLessEqual:    "LESS_EQUAL",
+	OpAdd:          "ADD",
+	OpSubtract:     "SUBTRACT",
+	OpMultiply:     "MULTIPLY",
+	OpDivide:       "DIVIDE",
+	OpNot:          "NOT",
+	OpNegate:       "NEGATE",
+	OpPrint:        "PRINT",
+	OpReturn:       "RETURN",
+}
+
+func (op OpCode) String() string {
+	if int(op) < len(opCodeNames) && opCodeNames[op] != "" {
+		return opCodeNames[op]
+	}
+	return fmt.Sprintf("%d", op)
+}
+
+// binaryOpCodes are the instructions of the binary operators the VM supports.
+var binaryOpCodes = map[TokenType]OpCode{
+	TokenEqualEqual:   OpEqual,
+	TokenBangEqual:    OpNotEqual,
+	TokenGreater:      OpGreater,
+	TokenGreaterEqual: OpGreaterEqual,
+	TokenLess:         OpLess,
+	TokenLessEqual:    OpLessEqual,
+	TokenPlus:         OpAdd,
+	TokenMinus:        OpSubtract,
+	TokenStar:         OpMultiply,
+	TokenSlash:        OpDivide,
+}
+
+// Chunk is compiled bytecode, ready to be run by the VM.
+type Chunk struct {
+	Code      []byte
+	Constants []interface{}
+	// The token each byte of code was compiled from, to report runtime errors at
+	Tokens []Token
+}
+
+func (chunk *Chunk) write(b byte, token Token) {
+	chunk.Code = append(chunk.Code, b)
+	chunk.Tokens = append(chunk.Tokens, token)
+}
+
+// readUint16 reads the 2-byte operand at the offset.
+func (chunk *Chunk) readUint16(offset int) uint16 {
+	return uint16(chunk.Code[offset])<<8 | uint16(chunk.Code[offset+1])
+}
+
+// Disassemble lists the instructions of the chunk, one per line, e.g. for debugging.
+func (chunk *Chunk) Disassemble() string {
+	lines := []string{}
+	for offset := 0; offset < len(chunk.Code); {
+		op := OpCode(chunk.Code[offset])
+		if op == OpConstant {
+			index := chunk.readUint16(offset + 1)
+			lines = append(lines, fmt.Sprintf("%04d %s %d '%s'", offset, op, index, stringify(chunk.Constants[index])))
+			offset += 3
+		} else if op == OpPrint {
+			lines = append(lines, fmt.Sprintf("%04d %s %d", offset, op, chunk.Code[offset+1]))
+			offset += 2
+		} else {
+			lines = append(lines, fmt.Sprintf("%04d %s", offset, op))
+			offset++
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Compile compiles the statements to bytecode for the VM. The VM only supports part of
+// the language so far; code that it can't run is reported to the reporter, and an error
+// is returned.
+func Compile(statements []Stmt, reporter ErrorReporter) (chunk *Chunk, e error) {
+	compiler := compiler{chunk: &Chunk{}, reporter: reporter}
+	for _, stmt := range statements {
+		if e, _ = stmt.Visit(compiler); e != nil {
+			return nil, e
+		}
+	}
+	compiler.chunk.write(byte(OpReturn), Token{})
+	return compiler.chunk, nil
+}
+
+// compiler compiles the AST to bytecode. Each visit emits the instructions of the node.
+type compiler struct {
+	chunk    *Chunk
+	reporter ErrorReporter
+}
+
+func (compiler compiler) emit(op OpCode, token Token) {
+	compiler.chunk.write(byte(op), token)
+}
+
+func (compiler compiler) emitConstant(value interface{}, token Token) error {
+	if len(compiler.chunk.Constants) > math.MaxUint16 {
+		return compiler.error(token, "Too many constants in one chunk.")
+	}
+	index := uint16(len(compiler.chunk.Constants))
+	compiler.chunk.Constants = append(compiler.chunk.Constants, value)
+	compiler.emit(OpConstant, token)
+	compiler.chunk.write(byte(index>>8), token)
+	compiler.chunk.write(byte(index), token)
+	return nil
+}
+
+// error reports the error at the token, and returns it so that compiling stops.
+func (compiler compiler) error(token Token, message string) error {
+	compiler.reporter.Error(token.Line, token.Column, message)
+	return errors.New(message)
+}
+
+// unsupported reports that the VM can't run the code at the token yet.
+func (compiler compiler) unsupported(token Token, what string) (error, interface{}) {
+	return compiler.error(token, fmt.Sprintf("The VM doesn't support %s yet.", what)), nil
+}
+
+func (compiler compiler) VisitExpression(stmt Expression) (error, interface{}) {
+	if e, _ := stmt.Expression.Visit(compiler); e != nil {
+		return e, nil
+	}
+	compiler.emit(OpPop, Token{})
+	return nil, nil
+}
+
+func (compiler compiler) VisitPrint(stmt Print) (error, interface{}) {
+	for _, expr := range stmt.Expressions {
+		if e, _ := expr.Visit(compiler); e != nil {
+			return e, nil
+		}
+	}
+	// The parser limits the number of values so that the count fits in a byte.
+	compiler.emit(OpPrint, Token{})
+	compiler.chunk.write(byte(len(stmt.Expressions)), Token{})
+	return nil, nil
+}
+
+func (compiler compiler) VisitVar(stmt Var) (error, interface{}) {
+	return compiler.unsupported(stmt.Name, "variables")
+}
+
+func (compiler compiler) VisitBlock(stmt Block) (error, interface{}) {
+	// A block has no token to report at, but without local variables its statements
+	// compile the same as they do outside of it.
+	for _, statement := range stmt.Statements {
+		if e, _ := statement.Visit(compiler); e != nil {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (compiler compiler) VisitIf(stmt If) (error, interface{}) {
+	return compiler.unsupported(stmt.Keyword, "if statements")
+}
+
+func (compiler compiler) VisitWhile(stmt While) (error, interface{}) {
+	return compiler.unsupported(stmt.Keyword, "loops")
+}
+
+func (compiler compiler) VisitSwitch(stmt Switch) (error, interface{}) {
+	return compiler.unsupported(stmt.Keyword, "switch statements")
+}
+
+func (compiler compiler) VisitDoWhile(stmt DoWhile) (error, interface{}) {
+	return compiler.unsupported(stmt.Keyword, "loops")
+}
+
+func (compiler compiler) VisitFunction(stmt Function) (error, interface{}) {
+	return compiler.unsupported(stmt.Name, "functions")
+}
+
+func (compiler compiler) VisitReturn(stmt Return) (error, interface{}) {
+	return compiler.unsupported(stmt.Keyword, "functions")
+}
+
+func (compiler compiler) VisitBreak(stmt Break) (error, interface{}) {
+	return compiler.unsupported(stmt.Keyword, "loops")
+}
+
+func (compiler compiler) VisitContinue(stmt Continue) (error, interface{}) {
+	return compiler.unsupported(stmt.Keyword, "loops")
+}
+
+func (compiler compiler) VisitClass(stmt Class) (error, interface{}) {
+	return compiler.unsupported(stmt.Name, "classes")
+}
+
+func (compiler compiler) VisitBinary(expr Binary) (error, interface{}) {
+	op, isSupported := binaryOpCodes[expr.Operator.Type]
+	if !isSupported {
+		return compiler.unsupported(expr.Operator, "the "+expr.Operator.Lexeme+" operator")
+	}
+	if e, _ := expr.Left.Visit(compiler); e != nil {
+		return e, nil
+	}
+	if e, _ := expr.Right.Visit(compiler); e != nil {
+		return e, nil
+	}
+	compiler.emit(op, expr.Operator)
+	return nil, nil
+}
+
+func (compiler compiler) VisitGrouping(expr Grouping) (error, interface{}) {
+	return expr.Expression.Visit(compiler)
+}
+
+func (compiler compiler) VisitLiteral(expr Literal) (error, interface{}) {
+	switch value := unwrap(expr.Value).(type) {
+	case nil:
+		compiler.emit(OpNil, Token{})
+	case bool:
+		if value {
+			compiler.emit(OpTrue, Token{})
+		} else {
+			compiler.emit(OpFalse, Token{})
+		}
+	default:
+		return compiler.emitConstant(value, Token{}), nil
+	}
+	return nil, nil
+}
+
+func (compiler compiler) VisitUnary(expr Unary) (error, interface{}) {
+	var op OpCode
+	switch expr.Operator.Type {
+	case TokenMinus:
+		op = OpNegate
+	case TokenBang:
+		op = OpNot
+	default:
+		return compiler.unsupported(expr.Operator, "the "+expr.Operator.Lexeme+" operator")
+	}
+	if e, _ := expr.Right.Visit(compiler); e != nil {
+		return e, nil
+	}
+	compiler.emit(op, expr.Operator)
+	return nil, nil
+}
+
+func (compiler compiler) VisitTernary(expr Ternary) (error, interface{}) {
+	return compiler.unsupported(expr.Question, "the ternary operator")
+}
+
+func (compiler compiler) VisitVariable(expr Variable) (error, interface{}) {
+	return compiler.unsupported(expr.Name, "variables")
+}
+
+func (compiler compiler) VisitAssign(expr Assign) (error, interface{}) {
+	return compiler.unsupported(expr.Name, "variables")
+}
+
+func (compiler compiler) VisitLogical(expr Logical) (error, interface{}) {
+	return compiler.unsupported(expr.Operator, "the "+expr.Operator.Lexeme+" operator")
+}
+
+func (compiler compiler) VisitCall(expr Call) (error, interface{}) {
+	return compiler.unsupported(expr.Paren, "calls")
+}
+
+func (compiler compiler) VisitList(expr List) (error, interface{}) {
+	return compiler.unsupported(expr.Bracket, "lists")
+}
+
+func (compiler compiler) VisitIndex(expr Index) (error, interface{}) {
+	return compiler.unsupported(expr.Bracket, "indexing")
+}
+
+func (compiler compiler) VisitSetIndex(expr SetIndex) (error, interface{}) {
+	return compiler.unsupported(expr.Bracket, "indexing")
+}
+
+func (compiler compiler) VisitMap(expr Map) (error, interface{}) {
+	return compiler.unsupported(expr.Brace, "maps")
+}
+
+func (compiler compiler) VisitGet(expr Get) (error, interface{}) {
+	return compiler.unsupported(expr.Name, "classes")
+}
+
+func (compiler compiler) VisitSet(expr Set) (error, interface{}) {
+	return compiler.unsupported(expr.Name, "classes")
+}
+
+func (compiler compiler) VisitThis(expr This) (error, interface{}) {
+	return compiler.unsupported(expr.Keyword, "classes")
+}
+
+func (compiler compiler) VisitSuper(expr Super) (error, interface{}) {
+	return compiler.unsupported(expr.Keyword, "classes")
+}
+
+func (compiler compiler) VisitLambda(expr Lambda) (error, interface{}) {
+	return compiler.unsupported(expr.Declaration.Name, "functions")
+}
+
+func (compiler compiler) VisitInterpolation(expr Interpolation) (error, interface{}) {
+	return compiler.unsupported(expr.Start, "string interpolation")
+}
@@ -0,0 +1,80 @@
+package internal
+
+import "fmt"
+
+// Environment binds variable names to their values. Environments are nested to implement
+// lexical scope: names that are not found are looked up in the enclosing environment.
+type Environment struct {
+	values    map[string]interface{}
+	enclosing *Environment // The environment of the surrounding scope, or nil for the global scope
+}
+
+func NewEnvironment(enclosing *Environment) *Environment {
+	return &Environment{
+		values:    make(map[string]interface{}),
+		enclosing: enclosing,
+	}
+}
+
+// Define binds the name to the value. Redefining an existing variable is allowed and
+// simply replaces the old value.
+func (environment *Environment) Define(name string, value interface{}) {
+	environment.values[name] = value
+}
+
+// Get looks up the value of the variable, returning a runtime error if it is not defined.
+func (environment *Environment) Get(name Token) (error, interface{}) {
+	if value, found := environment.values[name.Lexeme]; found {
+		return nil, value
+	}
+	if environment.enclosing != nil {
+		return environment.enclosing.Get(name)
+	}
+	return undefinedVariable(name), nil
+}
+
+// Assign replaces the value of an existing variable. Assignment cannot create a variable.
+func (environment *Environment) Assign(name Token, value interface{}) error {
+	if _, found := environment.values[name.Lexeme]; found {
+		environment.values[name.Lexeme] = value
+		return nil
+	}
+	if environment.enclosing != nil {
+		return environment.enclosing.Assign(name, value)
+	}
+	return undefinedVariable(name)
+}
+
+// GetAt looks up the value of the variable in the environment distance levels up, without
+// looking any further.
+func (environment *Environment) GetAt(distance int, name Token) (error, interface{}) {
+	if value, found := environment.ancestor(distance).values[name.Lexeme]; found {
+		return nil, value
+	}
+	return undefinedVariable(name), nil
+}
+
+// AssignAt replaces the value of the variable in the environment distance levels up,
+// without looking any further.
+func (environment *Environment) AssignAt(distance int, name Token, value interface{}) error {
+	ancestor := environment.ancestor(distance)
+	if _, found := ancestor.values[name.Lexeme]; !found {
+		return undefinedVariable(name)
+	}
+	ancestor.values[name.Lexeme] = value
+	return nil
+}
+
+func (environment *Environment) ancestor(distance int) *Environment {
+	for i := 0; i < distance; i++ {
+		environment = environment.enclosing
+	}
+	return environment
+}
+
+func undefinedVariable(name Token) RuntimeError {
+	return RuntimeError{
+		Token: name,
+		Msg:   fmt.Sprintf("Undefined variable '%s'.", name.Lexeme),
+	}
+}
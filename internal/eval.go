@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"io/ioutil"
+)
+
+// Eval parses and evaluates a single Lox expression, e.g. `1 + 2`, and returns the resulting
+// Golang value: nil, bool, int64, float64, string or a LoxCallable. Nothing is printed; any
+// scanning, parsing or runtime errors are combined into the returned error.
+func Eval(source []byte) (interface{}, error) {
+	reporter := CollectingErrorReporter{}
+	scanner := NewScanner(source, &reporter)
+	tokens := scanner.ScanTokens()
+	parser := NewParser(tokens, &reporter)
+	expr, _ := parser.ParseExpression()
+	if len(reporter.Errors()) > 0 {
+		return nil, reporter.combined()
+	}
+
+	interpreter := NewInterpreter(&reporter, ioutil.Discard)
+	resolver := NewResolver(&interpreter, &reporter)
+	if e := resolver.ResolveExpression(expr); e != nil {
+		return nil, reporter.combined()
+	}
+	e, value := interpreter.visit(expr)
+	if e != nil {
+		return nil, e
+	}
+	return value, nil
+}
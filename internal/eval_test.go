@@ -0,0 +1,36 @@
+package internal
+
+import "testing"
+
+func TestEvalValues(t *testing.T) {
+	tests := map[string]interface{}{
+		"1 + 2":          int64(3),
+		`"a" + "b"`:      "ab",
+		"1 < 2":          true,
+		"nil":            nil,
+		"true ? 1 : 2":   int64(1),
+		"nil or \"yes\"": "yes",
+	}
+	for source, expected := range tests {
+		value, e := Eval([]byte(source))
+		if e != nil {
+			t.Errorf("unexpected error evaluating %s: %v", source, e)
+		} else if value != expected {
+			t.Errorf("expected %s to be %#v, got %#v", source, expected, value)
+		}
+	}
+
+	if value, _ := Eval([]byte("clock")); value == nil {
+		t.Error("expected clock to evaluate to a function")
+	} else if _, isCallable := value.(LoxCallable); !isCallable {
+		t.Errorf("expected clock to be callable, got %#v", value)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, source := range []string{"1 +", "1 2", "@", "-\"a\"", "undefined"} {
+		if value, e := Eval([]byte(source)); e == nil {
+			t.Errorf("expected an error evaluating %s, got %#v", source, value)
+		}
+	}
+}
@@ -4,64 +4,101 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
 type TokenType int
 
-// Define all token types.
+// Define all token types. The values are explicit, rather than using iota, so that they
+// never change when token types are added: new token types get the next unused value. The
+// name of a new token type must be added to tokenTypeNames.
 const (
-	// TODO: hardcode values instead of relying on iota. That will allow future compatibility
-	// as the value should not change over time, e.g. by entering a token between 2 tokens.
-
 	// Single-character tokens.
-	TokenLeftParen TokenType = iota
-	TokenRightParen
-	TokenLeftBrace
-	TokenRightBrace
-	TokenComma
-	TokenDot
-	TokenMinus
-	TokenPlus
-	TokenSemicolon
-	TokenSlash
-	TokenStar
-	TokenQuestion
-	TokenColon
+	TokenLeftParen    TokenType = 0
+	TokenRightParen   TokenType = 1
+	TokenLeftBrace    TokenType = 2
+	TokenRightBrace   TokenType = 3
+	TokenLeftBracket  TokenType = 4
+	TokenRightBracket TokenType = 5
+	TokenComma        TokenType = 6
+	TokenDot          TokenType = 7
+	TokenMinus        TokenType = 8
+	TokenPlus         TokenType = 9
+	TokenSemicolon    TokenType = 10
+	TokenSlash        TokenType = 11
+	TokenStar         TokenType = 12
+	TokenQuestion     TokenType = 13
+	TokenColon        TokenType = 14
 
 	// One or two character tokens.
-	TokenBang
-	TokenBangEqual
-	TokenEqual
-	TokenEqualEqual
-	TokenGreater
-	TokenGreaterEqual
-	TokenLess
-	TokenLessEqual
+	TokenBang         TokenType = 15
+	TokenBangEqual    TokenType = 16
+	TokenEqual        TokenType = 17
+	TokenEqualEqual   TokenType = 18
+	TokenGreater      TokenType = 19
+	TokenGreaterEqual TokenType = 20
+	TokenLess         TokenType = 21
+	TokenLessEqual    TokenType = 22
+	TokenPlusEqual    TokenType = 23
+	TokenMinusEqual   TokenType = 24
+	TokenStarEqual    TokenType = 25
+	TokenSlashEqual   TokenType = 26
 
 	// Literals.
-	TokenIdentifier
-	TokenString // Our strings are multiline. Preceding spaces are not trimmed.
-	TokenNumber
+	TokenIdentifier TokenType = 27
+	TokenString     TokenType = 28 // Our strings are multiline. Preceding spaces are not trimmed.
+	TokenNumber     TokenType = 29
 
 	// Keywords.
-	TokenAnd
-	TokenClass
-	TokenElse
-	TokenFalse
-	TokenFun
-	TokenFor
-	TokenIf
-	TokenNil
-	TokenOr
-	TokenPrint
-	TokenReturn
-	TokenSuper
-	TokenThis
-	TokenTrue
-	TokenVar
-	TokenWhile
-
-	TokenEof
+	TokenAnd      TokenType = 30
+	TokenBreak    TokenType = 31
+	TokenClass    TokenType = 32
+	TokenContinue TokenType = 33
+	TokenElse     TokenType = 34
+	TokenFalse    TokenType = 35
+	TokenFun      TokenType = 36
+	TokenFor      TokenType = 37
+	TokenIf       TokenType = 38
+	TokenNil      TokenType = 39
+	TokenOr       TokenType = 40
+	TokenPrint    TokenType = 41
+	TokenReturn   TokenType = 42
+	TokenSuper    TokenType = 43
+	TokenThis     TokenType = 44
+	TokenTrue     TokenType = 45
+	TokenVar      TokenType = 46
+	TokenWhile    TokenType = 47
+
+	TokenEof TokenType = 48
+
+	// Bitwise operators.
+	TokenAmpersand TokenType = 49
+	TokenPipe      TokenType = 50
+	TokenCaret     TokenType = 51
+	TokenTilde     TokenType = 52
+
+	TokenStarStar TokenType = 53
+	// Integer division. `//` starts a comment, so it is a keyword.
+	TokenDiv TokenType = 54
+
+	TokenSwitch  TokenType = 55
+	TokenCase    TokenType = 56
+	TokenDefault TokenType = 57
+	TokenDo      TokenType = 58
+
+	// Null-coalescing operator.
+	TokenQuestionQuestion TokenType = 59
+
+	// Only kept apart from the tokens when Scanner.KeepComments is set.
+	TokenComment TokenType = 60
+
+	// The part of an interpolated string before an embedded expression, e.g. "a ${b} c" is
+	// scanned as INTERPOLATION "a ", IDENTIFIER b, STRING " c".
+	TokenInterpolation TokenType = 61
 )
 
 // Token represents a lexeme read from the input code, the inferred type and the location
@@ -71,98 +108,101 @@ type Token struct {
 	Lexeme  string
 	Literal interface{}
 	Line    int
+	Column  int // The column of the first character of the lexeme, starting at 1
+	// Byte offsets of the lexeme in the source, such that source[StartOffset:EndOffset]
+	// is the exact text that was scanned.
+	StartOffset int
+	EndOffset   int
+}
+
+// tokenTypeNames are the readable names of the token types, indexed by type.
+var tokenTypeNames = [...]string{
+	TokenLeftParen:    "LEFT_PAREN",
+	TokenRightParen:   "RIGHT_PAREN",
+	TokenLeftBrace:    "LEFT_BRACE",
+	TokenRightBrace:   "RIGHT_BRACE",
+	TokenLeftBracket:  "LEFT_BRACKET",
+	TokenRightBracket: "RIGHT_BRACKET",
+	TokenComma:        "COMMA",
+	TokenDot:          "DOT",
+	TokenMinus:        "MINUS",
+	TokenPlus:         "PLUS",
+	TokenSemicolon:    "SEMICOLON",
+	TokenSlash:        "SLASH",
+	TokenStar:         "STAR",
+	TokenQuestion:     "QUESTION",
+	TokenColon:        "COLON",
+
+	TokenBang:         "BANG",
+	TokenBangEqual:    "BANG_EQUAL",
+	TokenEqual:        "EQUAL",
+	TokenEqualEqual:   "EQUAL_EQUAL",
+	TokenGreater:      "GREATER",
+	TokenGreaterEqual: "GREATER_EQUAL",
+	TokenLess:         "LESS",
+	TokenLessEqual:    "LESS_EQUAL",
+	TokenPlusEqual:    "PLUS_EQUAL",
+	TokenMinusEqual:   "MINUS_EQUAL",
+	TokenStarEqual:    "STAR_EQUAL",
+	TokenSlashEqual:   "SLASH_EQUAL",
+
+	TokenIdentifier: "IDENTIFIER",
+	TokenString:     "STRING",
+	TokenNumber:     "NUMBER",
+
+	TokenAnd:      "AND",
+	TokenBreak:    "BREAK",
+	TokenClass:    "CLASS",
+	TokenContinue: "CONTINUE",
+	TokenElse:     "ELSE",
+	TokenFalse:    "FALSE",
+	TokenFun:      "FUN",
+	TokenFor:      "FOR",
+	TokenIf:       "IF",
+	TokenNil:      "NIL",
+	TokenOr:       "OR",
+	TokenPrint:    "PRINT",
+	TokenReturn:   "RETURN",
+	TokenSuper:    "SUPER",
+	TokenThis:     "THIS",
+	TokenTrue:     "TRUE",
+	TokenVar:      "VAR",
+	TokenWhile:    "WHILE",
+
+	TokenEof: "EOF",
+
+	TokenAmpersand: "AMPERSAND",
+	TokenPipe:      "PIPE",
+	TokenCaret:     "CARET",
+	TokenTilde:     "TILDE",
+
+	TokenStarStar: "STAR_STAR",
+	TokenDiv:      "DIV",
+
+	TokenSwitch:  "SWITCH",
+	TokenCase:    "CASE",
+	TokenDefault: "DEFAULT",
+	TokenDo:      "DO",
+
+	TokenQuestionQuestion: "QUESTION_QUESTION",
+
+	TokenComment: "COMMENT",
+
+	TokenInterpolation: "INTERPOLATION",
+}
+
+func (tokenType TokenType) String() string {
+	if tokenType >= 0 && int(tokenType) < len(tokenTypeNames) && tokenTypeNames[tokenType] != "" {
+		return tokenTypeNames[tokenType]
+	}
+	return strconv.Itoa(int(tokenType))
 }
 
 func (token Token) String() string {
-	// Horrible translation but more readable than the integer.
-	tokenType := fmt.Sprintf("%d", token.Type)
-	if token.Type == TokenAnd {
-		tokenType = "AND"
-	} else if token.Type == TokenLeftParen {
-		tokenType = "LEFT_PAREN"
-	} else if token.Type == TokenRightParen {
-		tokenType = "RIGHT_PAREN"
-	} else if token.Type == TokenLeftBrace {
-		tokenType = "LEFT_BRACE"
-	} else if token.Type == TokenRightBrace {
-		tokenType = "RIGHT_BRACE"
-	} else if token.Type == TokenComma {
-		tokenType = "COMMA"
-	} else if token.Type == TokenDot {
-		tokenType = "DOT"
-	} else if token.Type == TokenMinus {
-		tokenType = "MINUS"
-	} else if token.Type == TokenPlus {
-		tokenType = "PLUS"
-	} else if token.Type == TokenSemicolon {
-		tokenType = "SEMICOLON"
-	} else if token.Type == TokenSlash {
-		tokenType = "SLASH"
-	} else if token.Type == TokenStar {
-		tokenType = "STAR"
-	} else if token.Type == TokenBang {
-		tokenType = "BANG"
-	} else if token.Type == TokenBangEqual {
-		tokenType = "BANG_EQUAL"
-	} else if token.Type == TokenEqual {
-		tokenType = "EQUAL"
-	} else if token.Type == TokenEqualEqual {
-		tokenType = "EQUAL_EQUAL"
-	} else if token.Type == TokenGreater {
-		tokenType = "GREATER"
-	} else if token.Type == TokenGreaterEqual {
-		tokenType = "GREATER_EQUAL"
-	} else if token.Type == TokenLess {
-		tokenType = "LESS"
-	} else if token.Type == TokenLessEqual {
-		tokenType = "LESS_EQUAL"
-	} else if token.Type == TokenIdentifier {
-		tokenType = "IDENTIFIER"
-	} else if token.Type == TokenString {
-		tokenType = "STRING"
-	} else if token.Type == TokenNumber {
-		tokenType = "NUMBER"
-	} else if token.Type == TokenAnd {
-		tokenType = "AND"
-	} else if token.Type == TokenClass {
-		tokenType = "CLASS"
-	} else if token.Type == TokenElse {
-		tokenType = "ELSE"
-	} else if token.Type == TokenFalse {
-		tokenType = "FALSE"
-	} else if token.Type == TokenFun {
-		tokenType = "FUN"
-	} else if token.Type == TokenFor {
-		tokenType = "FOR"
-	} else if token.Type == TokenIf {
-		tokenType = "IF"
-	} else if token.Type == TokenNil {
-		tokenType = "NIL"
-	} else if token.Type == TokenOr {
-		tokenType = "OR"
-	} else if token.Type == TokenPrint {
-		tokenType = "PRINT"
-	} else if token.Type == TokenReturn {
-		tokenType = "RETURN"
-	} else if token.Type == TokenSuper {
-		tokenType = "SUPER"
-	} else if token.Type == TokenThis {
-		tokenType = "THIS"
-	} else if token.Type == TokenTrue {
-		tokenType = "TRUE"
-	} else if token.Type == TokenVar {
-		tokenType = "VAR"
-	} else if token.Type == TokenWhile {
-		tokenType = "WHILE"
-	} else if token.Type == TokenEof {
-		tokenType = "EOF"
-	} else if token.Type == TokenColon {
-		tokenType = "COLON"
-	} else if token.Type == TokenQuestion {
-		tokenType = "QUESTION"
-	}
-
-	return fmt.Sprintf("%s %s %v", tokenType, token.Lexeme, token.Literal)
+	if token.Literal == nil {
+		return token.Type.String() + " " + token.Lexeme + " <nil>"
+	}
+	return fmt.Sprintf("%s %s %v", token.Type, token.Lexeme, token.Literal)
 }
 
 // Define helper structs for literal values.
@@ -173,7 +213,17 @@ type Number struct {
 }
 
 func (n Number) String() string {
-	return fmt.Sprintf("%.10f", n.V)
+	return formatNumber(n.V, ShortestDecimals)
+}
+
+// Integer wraps a glox integer, i.e. a number literal without a decimal point, to make it
+// printable.
+type Integer struct {
+	V int64
+}
+
+func (i Integer) String() string {
+	return strconv.FormatInt(i.V, 10)
 }
 
 // Boolean wraps a glox boolean to make it printable.
@@ -200,59 +250,166 @@ func (s String) String() string {
 
 // Define all the keywords
 var keywords = map[string]TokenType{
-	"and":    TokenAnd,
-	"class":  TokenClass,
-	"else":   TokenElse,
-	"false":  TokenFalse,
-	"for":    TokenFor,
-	"fun":    TokenFun,
-	"if":     TokenIf,
-	"nil":    TokenNil,
-	"or":     TokenOr,
-	"print":  TokenPrint,
-	"return": TokenReturn,
-	"super":  TokenSuper,
-	"this":   TokenThis,
-	"true":   TokenTrue,
-	"var":    TokenVar,
-	"while":  TokenWhile,
+	"and":      TokenAnd,
+	"break":    TokenBreak,
+	"case":     TokenCase,
+	"class":    TokenClass,
+	"continue": TokenContinue,
+	"default":  TokenDefault,
+	"div":      TokenDiv,
+	"do":       TokenDo,
+	"else":     TokenElse,
+	"false":    TokenFalse,
+	"for":      TokenFor,
+	"fun":      TokenFun,
+	"if":       TokenIf,
+	"nil":      TokenNil,
+	"or":       TokenOr,
+	"print":    TokenPrint,
+	"return":   TokenReturn,
+	"super":    TokenSuper,
+	"switch":   TokenSwitch,
+	"this":     TokenThis,
+	"true":     TokenTrue,
+	"var":      TokenVar,
+	"while":    TokenWhile,
 }
 
 // Scanner scans the source code left to right and returns a list of tokens interpreted from
 // the source code.
 type Scanner struct {
-	source   []byte
+	source   string // The source code, converted once so that lexemes can be sliced from it
+	runes    []rune // The characters of the source code
+	offsets  []int  // The byte offset of each character in the source code, and of the end
 	reporter ErrorReporter
+	// The number of columns between tab stops. A tab advances the column to the next tab
+	// stop, so that columns match editors that indent with tabs. 1 counts a tab as one
+	// column, like any other character.
+	TabWidth int
+	// Whether to keep comments, e.g. for formatters, rather than skip them. See CommentsBefore.
+	KeepComments bool
 	// Scanning state:
-	start   int     // The location of the first character in the current lexeme being scanned
-	current int     // The location of the current character in the current lexeme being scanned
-	line    int     // The line number of the current position in the code
-	tokens  []Token // Scanned tokens
+	start       int          // The index of the first character in the current lexeme being scanned
+	current     int          // The index of the current character in the current lexeme being scanned
+	line        int          // The line number of the current position in the code
+	column      int          // The column number of the current position in the code
+	startColumn int          // The column of the first character in the current lexeme being scanned
+	tokens      chan<- Token // Where scanned tokens are sent
+	// The position just past the last scanned token, where the EOF token is placed
+	endLine, endColumn, endCurrent int
+	// Whether the source ended inside a string or block comment
+	unterminated bool
+	hadError     bool // Whether a lexical error was found
+	// The interpolated expressions being scanned, innermost last
+	interpolations []interpolation
+	// The comments that have been kept, by the StartOffset of the token that follows them
+	comments map[int][]Token
+	// The comments that have been kept since the last token
+	pendingComments []Token
 }
 
 func NewScanner(source []byte, reporter ErrorReporter) Scanner {
+	// Decode the characters up front so that scanning can look at them by index. Invalid
+	// UTF-8 is decoded as utf8.RuneError, one byte at a time.
+	text := string(source)
+	runes := make([]rune, 0, len(text))
+	offsets := make([]int, 0, len(text)+1)
+	for offset, c := range text {
+		runes = append(runes, c)
+		offsets = append(offsets, offset)
+	}
+	offsets = append(offsets, len(text))
+
 	return Scanner{
-		source:   source,
-		reporter: reporter,
-		start:    0,
-		current:  0,
-		line:     1,
+		source:    text,
+		runes:     runes,
+		offsets:   offsets,
+		reporter:  reporter,
+		TabWidth:  1,
+		start:     0,
+		current:   0,
+		line:      1,
+		column:    1,
+		endLine:   1,
+		endColumn: 1,
 	}
 }
 
+// ScanTokens scans all tokens, ending with TokenEof.
 func (scanner *Scanner) ScanTokens() []Token {
-	for !scanner.isAtEnd() {
-		// We are at the beginning of the next lexeme.
-		scanner.start = scanner.current
-		scanner.scanToken()
+	// A rough guess of the number of tokens, to avoid growing the slice too often.
+	tokens := make([]Token, 0, len(scanner.runes)/4)
+	for token := range scanner.ScanChannel() {
+		tokens = append(tokens, token)
 	}
+	return tokens
+}
+
+// ScanChannel scans the tokens in the background, sending each token on the returned channel
+// as soon as it is scanned. The channel is closed after TokenEof is sent. The channel must be
+// drained, otherwise scanning never finishes.
+func (scanner *Scanner) ScanChannel() <-chan Token {
+	tokens := make(chan Token, 64)
+	scanner.tokens = tokens
+	go func() {
+		defer close(tokens)
+		// Scanning binary data would report an error for nearly every byte.
+		if looksBinary(scanner.runes) {
+			scanner.error(1, 1, "Input does not look like text.")
+			scanner.current = len(scanner.runes)
+		}
+		for !scanner.isAtEnd() {
+			// We are at the beginning of the next lexeme.
+			scanner.start = scanner.current
+			scanner.startColumn = scanner.column
+			scanner.scanToken()
+		}
 
-	scanner.tokens = append(scanner.tokens, Token{TokenEof, "", nil, scanner.line})
-	return scanner.tokens
+		// The EOF token directly follows the last token rather than any trailing whitespace
+		// and comments, so that errors at the end point at the code that is incomplete.
+		scanner.send(Token{
+			Type:        TokenEof,
+			Line:        scanner.endLine,
+			Column:      scanner.endColumn,
+			StartOffset: scanner.offsets[scanner.endCurrent],
+			EndOffset:   scanner.offsets[scanner.endCurrent],
+		})
+	}()
+	return tokens
+}
+
+// looksBinary reports whether the characters seem to be binary data rather than text, i.e.
+// more than a tenth of them are control characters other than whitespace, or invalid UTF-8.
+// A few such characters are still reported one by one as unexpected characters.
+func looksBinary(runes []rune) bool {
+	binary := 0
+	for _, c := range runes {
+		if c == utf8.RuneError || (unicode.IsControl(c) && !unicode.IsSpace(c)) {
+			binary++
+		}
+	}
+	return binary >= 8 && binary*10 > len(runes)
 }
 
-func (scanner Scanner) isAtEnd() bool {
-	return scanner.current >= len(scanner.source)
+// error reports a lexical error at the position.
+func (scanner *Scanner) error(line int, column int, msg string) {
+	scanner.hadError = true
+	scanner.reporter.Error(line, column, msg)
+}
+
+func (scanner *Scanner) isAtEnd() bool {
+	return scanner.current >= len(scanner.runes)
+}
+
+// interpolation is an interpolated expression being scanned, e.g. b in "a ${b} c".
+type interpolation struct {
+	line, column int // Where the ${ that starts the expression is
+	braces       int // The number of braces opened in the expression that haven't been closed yet
+}
+
+// lexeme returns the text of the current lexeme.
+func (scanner *Scanner) lexeme() string {
+	return scanner.source[scanner.offsets[scanner.start]:scanner.offsets[scanner.current]]
 }
 
 func (scanner *Scanner) scanToken() {
@@ -262,25 +419,68 @@ func (scanner *Scanner) scanToken() {
 	case ')':
 		scanner.addToken(TokenRightParen)
 	case '{':
+		if n := len(scanner.interpolations); n > 0 {
+			scanner.interpolations[n-1].braces++
+		}
 		scanner.addToken(TokenLeftBrace)
 	case '}':
-		scanner.addToken(TokenRightBrace)
+		n := len(scanner.interpolations)
+		if n > 0 && scanner.interpolations[n-1].braces == 0 {
+			// The end of an interpolated expression, after which the string continues.
+			scanner.interpolations = scanner.interpolations[:n-1]
+			scanner.string('"')
+		} else {
+			if n > 0 {
+				scanner.interpolations[n-1].braces--
+			}
+			scanner.addToken(TokenRightBrace)
+		}
+	case '[':
+		scanner.addToken(TokenLeftBracket)
+	case ']':
+		scanner.addToken(TokenRightBracket)
 	case ',':
 		scanner.addToken(TokenComma)
 	case '.':
 		scanner.addToken(TokenDot)
 	case '-':
-		scanner.addToken(TokenMinus)
+		if scanner.match('=') {
+			scanner.addToken(TokenMinusEqual)
+		} else {
+			scanner.addToken(TokenMinus)
+		}
 	case '+':
-		scanner.addToken(TokenPlus)
+		if scanner.match('=') {
+			scanner.addToken(TokenPlusEqual)
+		} else {
+			scanner.addToken(TokenPlus)
+		}
 	case ';':
 		scanner.addToken(TokenSemicolon)
 	case '*':
-		scanner.addToken(TokenStar)
+		if scanner.match('=') {
+			scanner.addToken(TokenStarEqual)
+		} else if scanner.match('*') {
+			scanner.addToken(TokenStarStar)
+		} else {
+			scanner.addToken(TokenStar)
+		}
 	case '?':
-		scanner.addToken(TokenQuestion)
+		if scanner.match('?') {
+			scanner.addToken(TokenQuestionQuestion)
+		} else {
+			scanner.addToken(TokenQuestion)
+		}
 	case ':':
 		scanner.addToken(TokenColon)
+	case '&':
+		scanner.addToken(TokenAmpersand)
+	case '|':
+		scanner.addToken(TokenPipe)
+	case '^':
+		scanner.addToken(TokenCaret)
+	case '~':
+		scanner.addToken(TokenTilde)
 	case '!':
 		if scanner.match('=') {
 			scanner.addToken(TokenBangEqual)
@@ -312,6 +512,15 @@ func (scanner *Scanner) scanToken() {
 			for scanner.peek() != '\n' && !scanner.isAtEnd() {
 				scanner.advance()
 			}
+			scanner.addComment(scanner.line, scanner.lexeme()[2:])
+		} else if scanner.match('*') {
+			line := scanner.line
+			if scanner.blockComment() {
+				lexeme := scanner.lexeme()
+				scanner.addComment(line, lexeme[2:len(lexeme)-2])
+			}
+		} else if scanner.match('=') {
+			scanner.addToken(TokenSlashEqual)
 		} else {
 			scanner.addToken(TokenSlash)
 		}
@@ -322,22 +531,33 @@ func (scanner *Scanner) scanToken() {
 		break
 	case '\n':
 		scanner.line++
-	case '"':
-		scanner.string()
+	case '"', '`':
+		scanner.string(c)
 	default:
 		if scanner.isDigit(c) {
 			scanner.number()
 		} else if scanner.isAlpha(c) {
 			scanner.identifier()
 		} else {
-			scanner.reporter.Error(scanner.line, "Unexpected character.")
+			// %q escapes control characters, which would otherwise be invisible.
+			scanner.error(scanner.line, scanner.startColumn, fmt.Sprintf("Unexpected character %q (%U).", c, c))
 		}
 	}
 }
 
-func (scanner *Scanner) advance() byte {
+// advance consumes the next character. Characters are UTF-8 encoded runes so a single
+// character may span several bytes of the source.
+func (scanner *Scanner) advance() rune {
+	c := scanner.runes[scanner.current]
 	scanner.current++
-	return scanner.source[scanner.current-1]
+	if c == '\n' {
+		scanner.column = 1
+	} else if c == '\t' && scanner.TabWidth > 1 {
+		scanner.column += scanner.TabWidth - (scanner.column-1)%scanner.TabWidth
+	} else {
+		scanner.column++
+	}
+	return c
 }
 
 func (scanner *Scanner) addToken(tokenType TokenType) {
@@ -345,58 +565,319 @@ func (scanner *Scanner) addToken(tokenType TokenType) {
 }
 
 func (scanner *Scanner) addLiteralToken(tokenType TokenType, literal interface{}) {
-	text := string(scanner.source[scanner.start:scanner.current])
-	scanner.tokens = append(scanner.tokens, Token{tokenType, text, literal, scanner.line})
+	scanner.send(Token{
+		Type:        tokenType,
+		Lexeme:      scanner.lexeme(),
+		Literal:     literal,
+		Line:        scanner.line,
+		Column:      scanner.startColumn,
+		StartOffset: scanner.offsets[scanner.start],
+		EndOffset:   scanner.offsets[scanner.current],
+	})
+	scanner.endLine, scanner.endColumn, scanner.endCurrent = scanner.line, scanner.column, scanner.current
+}
+
+// send sends the token, attaching the comments kept since the previous token to it.
+func (scanner *Scanner) send(token Token) {
+	if len(scanner.pendingComments) > 0 {
+		if scanner.comments == nil {
+			scanner.comments = make(map[int][]Token)
+		}
+		scanner.comments[token.StartOffset] = scanner.pendingComments
+		scanner.pendingComments = nil
+	}
+	scanner.tokens <- token
+}
+
+// addComment keeps the comment that was just scanned if KeepComments is set. The literal
+// is the text of the comment without the comment markers and surrounding whitespace.
+func (scanner *Scanner) addComment(line int, text string) {
+	if !scanner.KeepComments {
+		return
+	}
+	scanner.pendingComments = append(scanner.pendingComments, Token{
+		Type:        TokenComment,
+		Lexeme:      scanner.lexeme(),
+		Literal:     strings.TrimSpace(text),
+		Line:        line,
+		Column:      scanner.startColumn,
+		StartOffset: scanner.offsets[scanner.start],
+		EndOffset:   scanner.offsets[scanner.current],
+	})
+}
+
+// CommentsBefore returns the comments between the token and the token before it, as
+// TokenComment tokens, if KeepComments is set. The comments at the end of the source are
+// those before TokenEof. It must only be called once scanning has finished.
+func (scanner *Scanner) CommentsBefore(token Token) []Token {
+	return scanner.comments[token.StartOffset]
 }
 
 // Match is a conditional advance.
-func (scanner *Scanner) match(expected byte) bool {
+func (scanner *Scanner) match(expected rune) bool {
 	if scanner.isAtEnd() {
 		return false
 	}
-	if scanner.source[scanner.current] != expected {
+	if scanner.peek() != expected {
 		return false
 	}
 
-	scanner.current++
+	scanner.advance()
 	return true
 }
 
-func (scanner *Scanner) peek() byte {
+func (scanner *Scanner) peek() rune {
 	if scanner.isAtEnd() {
 		return 0
 	}
-	return scanner.source[scanner.current]
+	return scanner.runes[scanner.current]
 }
 
-func (scanner *Scanner) string() {
+// string scans a string literal that ends with the quote. Escape sequences are decoded in
+// "double quoted" strings, while `raw strings` keep every backslash, e.g. for paths.
+//
+// Double quoted strings may embed expressions, e.g. "a ${b} c". The part before an
+// expression is a TokenInterpolation, after which the tokens of the expression are
+// scanned as usual until its closing brace, where the rest of the string is scanned.
+func (scanner *Scanner) string(quote rune) {
+	value := strings.Builder{}
+	line := scanner.line
+	// Where the first line of the string ends, in case the string is unterminated
+	lineEnd, lineEndColumn, lineEndLength := -1, 0, 0
+
 	// Scan until string or input end.
-	for scanner.peek() != '"' && !scanner.isAtEnd() {
-		if scanner.peek() == '\n' {
+	for scanner.peek() != quote && !scanner.isAtEnd() {
+		if quote == '"' && scanner.peek() == '$' && scanner.peekNext() == '{' {
+			open := interpolation{line: scanner.line, column: scanner.column}
+			scanner.advance()
+			scanner.advance()
+			scanner.interpolations = append(scanner.interpolations, open)
+			scanner.addLiteralToken(TokenInterpolation, value.String())
+			return
+		}
+		if c := scanner.peek(); lineEnd < 0 && (c == '\n' || c == '\r') {
+			if scanner.closesInterpolatedString(line) {
+				return
+			}
+			lineEnd, lineEndColumn, lineEndLength = scanner.current, scanner.column, value.Len()
+		}
+		c := scanner.advance()
+		switch c {
+		case '\n':
 			scanner.line++
+			value.WriteRune(c)
+		case '\r':
+			// A string spanning lines has the same value whatever the line endings of
+			// the file. A carriage return can still be written as \r.
+			if scanner.peek() != '\n' {
+				value.WriteRune(c)
+			}
+		case '\\':
+			if quote == '`' {
+				value.WriteRune(c)
+			} else {
+				scanner.escape(&value)
+			}
+		default:
+			value.WriteRune(c)
 		}
-		scanner.advance()
 	}
 
-	// Unterminated string.
+	// Unterminated string. Most likely the closing quote is missing rather than the string
+	// running to the end of the input, so the string is cut off at the end of its first
+	// line and scanning resumes there. That way the code that follows is still checked.
+	if scanner.isAtEnd() && scanner.closesInterpolatedString(line) {
+		return
+	}
 	if scanner.isAtEnd() {
-		scanner.reporter.Error(scanner.line, "Unterminated string.")
+		scanner.unterminated = true
+		scanner.error(line, scanner.startColumn, "Unterminated string.")
+		text := value.String()
+		if lineEnd >= 0 {
+			scanner.current, scanner.line, scanner.column = lineEnd, line, lineEndColumn
+			text = text[:lineEndLength]
+		}
+		scanner.addLiteralToken(TokenString, text)
 		return
 	}
 
-	// The closing ".
+	// The closing quote.
 	scanner.advance()
 
-	// Trim the surrounding quotes to track the string token.
-	value := string(scanner.source[scanner.start+1 : scanner.current-1])
-	scanner.addLiteralToken(TokenString, value)
+	scanner.addLiteralToken(TokenString, value.String())
 }
 
-func (scanner *Scanner) isDigit(c byte) bool {
+// closesInterpolatedString handles a string that started inside an interpolated
+// expression but doesn't end on its line, e.g. "a ${b";. Rather than starting a string,
+// its quote most likely ends the interpolated string, with the closing brace of the
+// expression missing.
+// The string started on the line.
+// The missing brace is reported at the ${, and the quote is scanned as the end of the
+// string. It returns whether the string was handled this way.
+func (scanner *Scanner) closesInterpolatedString(line int) bool {
+	n := len(scanner.interpolations)
+	if n == 0 || scanner.interpolations[n-1].braces > 0 || scanner.runes[scanner.start] != '"' {
+		return false
+	}
+	open := scanner.interpolations[n-1]
+	scanner.interpolations = scanner.interpolations[:n-1]
+	scanner.error(open.line, open.column, "Expect '}' after interpolated expression.")
+	scanner.current = scanner.start
+	scanner.line, scanner.column = line, scanner.startColumn
+	scanner.advance()
+	scanner.addLiteralToken(TokenString, "")
+	return true
+}
+
+// escape decodes the escape sequence following a backslash inside a string and writes
+// the result to value. Malformed escapes are reported and skipped so the rest of the
+// string can still be scanned.
+func (scanner *Scanner) escape(value *strings.Builder) {
+	if scanner.isAtEnd() {
+		return
+	}
+
+	switch c := scanner.advance(); c {
+	case 'n':
+		value.WriteByte('\n')
+	case 't':
+		value.WriteByte('\t')
+	case 'r':
+		value.WriteByte('\r')
+	case '"':
+		value.WriteByte('"')
+	case '\\':
+		value.WriteByte('\\')
+	case '$':
+		// E.g. "\${a}" is the text ${a} rather than an interpolation.
+		value.WriteByte('$')
+	case 'u':
+		if r, ok := scanner.unicodeEscape(); ok {
+			value.WriteRune(r)
+		}
+	default:
+		scanner.error(scanner.line, scanner.column, fmt.Sprintf("Invalid escape sequence '\\%c'.", c))
+	}
+}
+
+// unicodeEscape decodes the code point of a \uXXXX or \u{X...} escape. The leading \u
+// has already been consumed. A high surrogate written as \uXXXX must be directly followed
+// by a low surrogate escape, and the pair is combined into a single code point.
+func (scanner *Scanner) unicodeEscape() (rune, bool) {
+	var r rune
+	if scanner.match('{') {
+		digits := 0
+		for scanner.isHexDigit(scanner.peek()) {
+			digit := hexValue(scanner.advance())
+			if r <= unicode.MaxRune { // Stop accumulating once out of range to avoid overflow.
+				r = r*16 + digit
+			}
+			digits++
+		}
+		if digits == 0 || !scanner.match('}') || r > unicode.MaxRune {
+			scanner.error(scanner.line, scanner.column, "Invalid unicode escape: expected 1 to 6 hex digits up to 10FFFF in \\u{...}.")
+			return 0, false
+		}
+	} else {
+		var ok bool
+		if r, ok = scanner.hexQuad(); !ok {
+			return 0, false
+		}
+		if utf16.IsSurrogate(r) && r < 0xdc00 && scanner.peek() == '\\' && scanner.peekNext() == 'u' {
+			scanner.advance()
+			scanner.advance()
+			low, ok := scanner.hexQuad()
+			if !ok {
+				return 0, false
+			}
+			if combined := utf16.DecodeRune(r, low); combined != unicode.ReplacementChar {
+				return combined, true
+			}
+		}
+	}
+
+	if utf16.IsSurrogate(r) {
+		scanner.error(scanner.line, scanner.column, "Invalid unicode escape: unpaired surrogate.")
+		return 0, false
+	}
+	return r, true
+}
+
+// hexQuad reads the four hex digits of a \uXXXX escape.
+func (scanner *Scanner) hexQuad() (rune, bool) {
+	var r rune
+	for i := 0; i < 4; i++ {
+		if !scanner.isHexDigit(scanner.peek()) {
+			scanner.error(scanner.line, scanner.column, "Invalid unicode escape: expected 4 hex digits after \\u.")
+			return 0, false
+		}
+		r = r*16 + hexValue(scanner.advance())
+	}
+	return r, true
+}
+
+func (scanner *Scanner) isHexDigit(c rune) bool {
+	return scanner.isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c rune) rune {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	default:
+		return c - '0'
+	}
+}
+
+// blockComment skips a /* ... */ comment. Block comments may be nested, so we track
+// the depth and only stop once every opening /* has been closed. It reports whether the
+// comment was closed.
+func (scanner *Scanner) blockComment() bool {
+	depth := 1
+	for depth > 0 {
+		if scanner.isAtEnd() {
+			scanner.unterminated = true
+			scanner.error(scanner.line, scanner.column, "Unterminated block comment.")
+			return false
+		}
+
+		switch c := scanner.advance(); c {
+		case '\n':
+			scanner.line++
+		case '/':
+			if scanner.match('*') {
+				depth++
+			}
+		case '*':
+			if scanner.match('/') {
+				depth--
+			}
+		}
+	}
+	return true
+}
+
+func (scanner *Scanner) isDigit(c rune) bool {
 	return c >= '0' && c <= '9'
 }
 
 func (scanner *Scanner) number() {
+	// The first digit has already been consumed, so a radix prefix is a 0 followed by x or b.
+	if scanner.runes[scanner.start] == '0' && scanner.current == scanner.start+1 {
+		switch scanner.peek() {
+		case 'x', 'X':
+			scanner.advance()
+			scanner.radixNumber(16, scanner.isHexDigit)
+			return
+		case 'b', 'B':
+			scanner.advance()
+			scanner.radixNumber(2, scanner.isBinaryDigit)
+			return
+		}
+	}
+
 	for scanner.isDigit(scanner.peek()) {
 		scanner.advance()
 	}
@@ -408,27 +889,70 @@ func (scanner *Scanner) number() {
 		}
 	}
 
-	value := string(scanner.source[scanner.start:scanner.current])
-	floatValue, err := strconv.ParseFloat(value, 64)
+	// Literals without a decimal point are integers, unless they are too large to be one.
+	if intValue, err := strconv.ParseInt(scanner.lexeme(), 10, 64); err == nil {
+		scanner.addLiteralToken(TokenNumber, Integer{V: intValue})
+		return
+	}
+	floatValue, err := strconv.ParseFloat(scanner.lexeme(), 64)
 	if err != nil { // This would be due to a compiler programmer's error
 		panic(err)
 	}
 	scanner.addLiteralToken(TokenNumber, Number{V: floatValue})
 }
 
-func (scanner *Scanner) peekNext() byte {
-	if scanner.current+1 >= len(scanner.source) {
+// radixNumber scans the digits of a hexadecimal or binary integer literal. The prefix has
+// already been consumed.
+func (scanner *Scanner) radixNumber(base float64, isRadixDigit func(rune) bool) {
+	digitsStart := scanner.current
+	for isRadixDigit(scanner.peek()) {
+		scanner.advance()
+	}
+
+	// Swallow the rest of a malformed literal such as 0xG so it isn't scanned as an identifier.
+	valid := scanner.current > digitsStart && !scanner.isAlphaNumeric(scanner.peek())
+	for scanner.isAlphaNumeric(scanner.peek()) {
+		scanner.advance()
+	}
+	if !valid {
+		scanner.error(scanner.line, scanner.startColumn, fmt.Sprintf("Invalid number literal '%s'.", scanner.lexeme()))
+		// The literal still counts as a number, so that the parser doesn't report a missing
+		// expression as well.
+		scanner.addLiteralToken(TokenNumber, Integer{V: 0})
+		return
+	}
+
+	// Like decimal literals, the value is an integer unless it is too large to be one.
+	digits := scanner.source[scanner.offsets[digitsStart]:scanner.offsets[scanner.current]]
+	if intValue, err := strconv.ParseInt(digits, int(base), 64); err == nil {
+		scanner.addLiteralToken(TokenNumber, Integer{V: intValue})
+		return
+	}
+	var value float64
+	for _, c := range scanner.runes[digitsStart:scanner.current] {
+		value = value*base + float64(hexValue(c))
+	}
+	scanner.addLiteralToken(TokenNumber, Number{V: value})
+}
+
+func (scanner *Scanner) isBinaryDigit(c rune) bool {
+	return c == '0' || c == '1'
+}
+
+func (scanner *Scanner) peekNext() rune {
+	if scanner.current+1 >= len(scanner.runes) {
 		return 0
 	}
-	return scanner.source[scanner.current+1]
+	return scanner.runes[scanner.current+1]
 }
 
-func (scanner Scanner) isAlpha(c byte) bool {
-	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+// Identifiers may contain any unicode letter, not just ASCII ones.
+func (scanner Scanner) isAlpha(c rune) bool {
+	return unicode.IsLetter(c) || c == '_'
 }
 
-func (scanner Scanner) isAlphaNumeric(c byte) bool {
-	return scanner.isAlpha(c) || scanner.isDigit(c)
+func (scanner Scanner) isAlphaNumeric(c rune) bool {
+	return scanner.isAlpha(c) || unicode.IsDigit(c)
 }
 
 func (scanner *Scanner) identifier() {
@@ -437,8 +961,7 @@ func (scanner *Scanner) identifier() {
 	}
 
 	// See if the identifier is a reserved word.
-	text := string(scanner.source[scanner.start:scanner.current])
-	tokenType, found := keywords[text]
+	tokenType, found := keywords[scanner.lexeme()]
 	if !found {
 		tokenType = TokenIdentifier
 	}
@@ -451,6 +974,24 @@ type Parser struct {
 	tokens   []Token
 	reporter ErrorReporter
 	current  int
+	hadError bool // Whether a syntax error was found
+	// Whether the first syntax error was found at the end of the input, i.e. the input is
+	// valid but unfinished
+	unfinished bool
+	// The number of function declarations enclosing the current token
+	functionDepth int
+	// The number of loops enclosing the current token within the current function
+	loopDepth int
+	// The number of statements enclosing the current token, including the current one
+	statementDepth int
+	// The number of class declarations enclosing the current token
+	classDepth int
+	// Whether the innermost class declaration enclosing the current token has a superclass
+	inSubclass bool
+	// Whether the innermost function enclosing the current token is an initializer
+	inInitializer bool
+	// The number of expressions being parsed that enclose the current token
+	nesting int
 }
 
 func NewParser(tokens []Token, reporter ErrorReporter) Parser {
@@ -461,27 +1002,436 @@ func NewParser(tokens []Token, reporter ErrorReporter) Parser {
 	}
 }
 
-func (parser Parser) Parse() (expr Expr, e error) {
+// Parse parses the tokens as a program, i.e. a list of statements. Parsing continues after
+// a syntax error so that as many errors as possible are reported, in which case an error
+// is returned alongside the statements that could be parsed.
+func (parser *Parser) Parse() ([]Stmt, error) {
+	var statements []Stmt
+	for !parser.isAtEnd() {
+		statements = append(statements, parser.declaration()...)
+	}
+
+	if parser.hadError {
+		return statements, errors.New("failed to parse")
+	}
+	return statements, nil
+}
+
+// ParseExpression parses the tokens as a single expression.
+func (parser Parser) ParseExpression() (expr Expr, e error) {
 	defer func() {
-		if _, isParseError := recover().(parseError); isParseError {
+		if r := recover(); r != nil {
+			if _, isParseError := r.(parseError); !isParseError {
+				panic(r)
+			}
 			expr = nil
 			e = errors.New("failed to parse")
 		}
 	}()
+
 	expr = parser.expression()
+	if !parser.isAtEnd() {
+		panic(parser.error(parser.peek(), "Expect end of expression."))
+	}
 	return
 }
 
+// declaration parses a single declaration or statement. It returns a list because a var
+// statement may declare several variables; after a syntax error the list is empty.
+func (parser *Parser) declaration() (stmts []Stmt) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, isParseError := r.(parseError); !isParseError {
+				panic(r)
+			}
+			parser.synchronize()
+			stmts = nil
+		}
+	}()
+	if parser.match(TokenClass) {
+		return []Stmt{parser.classDeclaration()}
+	}
+	// A function without a name is a lambda, which is parsed as part of an expression statement.
+	if parser.check(TokenFun) && parser.checkNext(TokenIdentifier) {
+		parser.advance()
+		return []Stmt{parser.function("function")}
+	}
+	if parser.match(TokenVar) {
+		return parser.varDeclaration()
+	}
+	return []Stmt{parser.statement()}
+}
+
+func (parser *Parser) classDeclaration() Stmt {
+	name := parser.consume(TokenIdentifier, "Expect class name.")
+
+	var superclass Expr
+	if parser.match(TokenLess) {
+		superclassName := parser.consume(TokenIdentifier, "Expect superclass name.")
+		if superclassName.Lexeme == name.Lexeme {
+			// No need to synchronize as the parser is not in a confused state.
+			parser.error(superclassName, "A class can't inherit from itself.")
+		}
+		superclass = Variable{Name: superclassName, Resolution: &Resolution{}}
+	}
+
+	parser.consume(TokenLeftBrace, "Expect '{' before class body.")
+
+	enclosingSubclass := parser.inSubclass
+	parser.classDepth++
+	parser.inSubclass = superclass != nil
+	defer func() {
+		parser.classDepth--
+		parser.inSubclass = enclosingSubclass
+	}()
+	var methods []Function
+	for !parser.check(TokenRightBrace) && !parser.isAtEnd() {
+		methods = append(methods, parser.function("method").(Function))
+	}
+
+	parser.consume(TokenRightBrace, "Expect '}' after class body.")
+	return Class{
+		Name:       name,
+		Superclass: superclass,
+		Methods:    methods,
+	}
+}
+
+// maxArguments is the maximum number of arguments, and therefore parameters, of a call.
+const maxArguments = 255
+
+// function parses the declaration of a function of the given kind, used in error messages.
+func (parser *Parser) function(kind string) Stmt {
+	name := parser.consume(TokenIdentifier, "Expect "+kind+" name.")
+	parser.consume(TokenLeftParen, "Expect '(' after "+kind+" name.")
+	params, body := parser.functionBody(kind, kind == "method" && name.Lexeme == "init")
+	return Function{
+		Name:   name,
+		Params: params,
+		Body:   body,
+	}
+}
+
+// functionBody parses the parameters, after the opening parenthesis, and the body of a
+// function of the given kind.
+func (parser *Parser) functionBody(kind string, initializer bool) ([]Token, []Stmt) {
+	var params []Token
+	if !parser.check(TokenRightParen) {
+		for {
+			if len(params) >= maxArguments {
+				parser.error(parser.peek(), fmt.Sprintf("Can't have more than %d parameters.", maxArguments))
+			}
+			params = append(params, parser.consume(TokenIdentifier, "Expect parameter name."))
+			if !parser.match(TokenComma) {
+				break
+			}
+		}
+	}
+	parser.consume(TokenRightParen, "Expect ')' after parameters.")
+
+	parser.consume(TokenLeftBrace, "Expect '{' before "+kind+" body.")
+	// Loops outside the function cannot be broken out of from within the function.
+	enclosingLoopDepth := parser.loopDepth
+	enclosingInitializer := parser.inInitializer
+	parser.functionDepth++
+	parser.loopDepth = 0
+	parser.inInitializer = initializer
+	defer func() {
+		parser.functionDepth--
+		parser.loopDepth = enclosingLoopDepth
+		parser.inInitializer = enclosingInitializer
+	}()
+	return params, parser.block()
+}
+
+// varDeclaration parses the comma-separated variables of a var statement, each of which
+// becomes its own Var. The initializers are parsed above the comma operator, as a comma
+// separates the variables.
+func (parser *Parser) varDeclaration() []Stmt {
+	var declarations []Stmt
+	for {
+		name := parser.consume(TokenIdentifier, "Expect variable name.")
+
+		var initializer Expr
+		if parser.match(TokenEqual) {
+			initializer = parser.assignment()
+		}
+		declarations = append(declarations, Var{
+			Name:        name,
+			Initializer: initializer,
+		})
+
+		if !parser.match(TokenComma) {
+			break
+		}
+	}
+
+	parser.consume(TokenSemicolon, "Expect ';' after variable declaration.")
+	return declarations
+}
+
+func (parser *Parser) statement() Stmt {
+	parser.statementDepth++
+	defer func() {
+		parser.statementDepth--
+	}()
+
+	if parser.match(TokenBreak, TokenContinue) {
+		return parser.loopControlStatement()
+	}
+	if parser.match(TokenDo) {
+		return parser.doWhileStatement()
+	}
+	if parser.match(TokenFor) {
+		return parser.forStatement()
+	}
+	if parser.match(TokenIf) {
+		return parser.ifStatement()
+	}
+	if parser.match(TokenPrint) {
+		return parser.printStatement()
+	}
+	if parser.match(TokenReturn) {
+		return parser.returnStatement()
+	}
+	if parser.match(TokenSwitch) {
+		return parser.switchStatement()
+	}
+	if parser.match(TokenWhile) {
+		return parser.whileStatement()
+	}
+	if parser.match(TokenLeftBrace) {
+		return Block{Statements: parser.block()}
+	}
+	return parser.expressionStatement()
+}
+
+// block parses the declarations of a block. The opening brace has already been consumed.
+func (parser *Parser) block() []Stmt {
+	var statements []Stmt
+	for !parser.check(TokenRightBrace) && !parser.isAtEnd() {
+		statements = append(statements, parser.declaration()...)
+	}
+
+	parser.consume(TokenRightBrace, "Expect '}' after block.")
+	return statements
+}
+
+func (parser *Parser) ifStatement() Stmt {
+	keyword := parser.previous()
+	parser.consume(TokenLeftParen, "Expect '(' after 'if'.")
+	condition := parser.expression()
+	parser.consume(TokenRightParen, "Expect ')' after if condition.")
+
+	// The else is bound to the nearest if as we eagerly look for it before returning.
+	thenBranch := parser.statement()
+	var elseBranch Stmt
+	if parser.match(TokenElse) {
+		elseBranch = parser.statement()
+	}
+
+	return If{
+		Keyword:    keyword,
+		Condition:  condition,
+		ThenBranch: thenBranch,
+		ElseBranch: elseBranch,
+	}
+}
+
+// printStatement parses the comma-separated values of a print statement. As a comma
+// separates the values, they are parsed above the comma operator.
+func (parser *Parser) printStatement() Stmt {
+	var values []Expr
+	for {
+		if len(values) >= maxArguments {
+			parser.error(parser.peek(), fmt.Sprintf("Can't print more than %d values.", maxArguments))
+		}
+		values = append(values, parser.assignment())
+		if !parser.match(TokenComma) {
+			break
+		}
+	}
+	parser.consume(TokenSemicolon, "Expect ';' after value.")
+	return Print{Expressions: values}
+}
+
+func (parser *Parser) returnStatement() Stmt {
+	keyword := parser.previous()
+	if parser.functionDepth == 0 {
+		// No need to synchronize as the parser is not in a confused state.
+		parser.error(keyword, "Can't return from top-level code.")
+	}
+
+	var value Expr
+	if !parser.check(TokenSemicolon) {
+		if parser.inInitializer {
+			// No need to synchronize as the parser is not in a confused state.
+			parser.error(keyword, "Can't return a value from an initializer.")
+		}
+		value = parser.expression()
+	}
+
+	parser.consume(TokenSemicolon, "Expect ';' after return value.")
+	return Return{
+		Keyword: keyword,
+		Value:   value,
+	}
+}
+
+// switchStatement parses the cases of a switch. The statements of a case run up to the next
+// case, the default or the closing brace; there is no fallthrough so they form a block.
+func (parser *Parser) switchStatement() Stmt {
+	keyword := parser.previous()
+	parser.consume(TokenLeftParen, "Expect '(' after 'switch'.")
+	subject := parser.expression()
+	parser.consume(TokenRightParen, "Expect ')' after switch value.")
+	parser.consume(TokenLeftBrace, "Expect '{' before switch cases.")
+
+	stmt := Switch{Keyword: keyword, Subject: subject}
+	for !parser.check(TokenRightBrace) && !parser.isAtEnd() {
+		if parser.match(TokenCase) {
+			stmt.Cases = append(stmt.Cases, parser.expression())
+			parser.consume(TokenColon, "Expect ':' after case value.")
+			stmt.Bodies = append(stmt.Bodies, parser.caseBody())
+		} else if parser.match(TokenDefault) {
+			if stmt.Default != nil {
+				// No need to synchronize as the parser is not in a confused state.
+				parser.error(parser.previous(), "Can't have more than one default in a switch.")
+			}
+			parser.consume(TokenColon, "Expect ':' after 'default'.")
+			stmt.Default = parser.caseBody()
+		} else {
+			panic(parser.error(parser.peek(), "Expect 'case' or 'default' in switch."))
+		}
+	}
+
+	parser.consume(TokenRightBrace, "Expect '}' after switch cases.")
+	return stmt
+}
+
+func (parser *Parser) caseBody() Stmt {
+	var statements []Stmt
+	for !parser.check(TokenCase) && !parser.check(TokenDefault) && !parser.check(TokenRightBrace) &&
+		!parser.isAtEnd() {
+		statements = append(statements, parser.declaration()...)
+	}
+	return Block{Statements: statements}
+}
+
+func (parser *Parser) doWhileStatement() Stmt {
+	keyword := parser.previous()
+	body := parser.loopBody()
+	parser.consume(TokenWhile, "Expect 'while' after do body.")
+	parser.consume(TokenLeftParen, "Expect '(' after 'while'.")
+	condition := parser.expression()
+	parser.consume(TokenRightParen, "Expect ')' after condition.")
+	parser.consume(TokenSemicolon, "Expect ';' after do-while condition.")
+
+	return DoWhile{
+		Keyword:   keyword,
+		Body:      body,
+		Condition: condition,
+	}
+}
+
+func (parser *Parser) whileStatement() Stmt {
+	keyword := parser.previous()
+	parser.consume(TokenLeftParen, "Expect '(' after 'while'.")
+	condition := parser.expression()
+	parser.consume(TokenRightParen, "Expect ')' after condition.")
+	body := parser.loopBody()
+
+	return While{
+		Keyword:   keyword,
+		Condition: condition,
+		Body:      body,
+	}
+}
+
+// forStatement parses a for loop, which is desugared to a while loop in a block that
+// declares the loop variable.
+func (parser *Parser) forStatement() Stmt {
+	keyword := parser.previous()
+	parser.consume(TokenLeftParen, "Expect '(' after 'for'.")
+
+	var initializers []Stmt
+	if parser.match(TokenSemicolon) {
+		// No initializer.
+	} else if parser.match(TokenVar) {
+		initializers = parser.varDeclaration()
+	} else {
+		initializers = []Stmt{parser.expressionStatement()}
+	}
+
+	// A missing condition loops forever.
+	var condition Expr = Literal{Value: Boolean{V: true}}
+	if !parser.check(TokenSemicolon) {
+		condition = parser.expression()
+	}
+	parser.consume(TokenSemicolon, "Expect ';' after loop condition.")
+
+	var increment Expr
+	if !parser.check(TokenRightParen) {
+		increment = parser.expression()
+	}
+	parser.consume(TokenRightParen, "Expect ')' after for clauses.")
+
+	var loop Stmt = While{
+		Keyword:   keyword,
+		Condition: condition,
+		Body:      parser.loopBody(),
+		Increment: increment,
+	}
+	if initializers != nil {
+		loop = Block{Statements: append(initializers, loop)}
+	}
+	return loop
+}
+
+// loopBody parses the body of a loop, in which break and continue may be used.
+func (parser *Parser) loopBody() Stmt {
+	parser.loopDepth++
+	defer func() {
+		parser.loopDepth--
+	}()
+	return parser.statement()
+}
+
+func (parser *Parser) loopControlStatement() Stmt {
+	keyword := parser.previous()
+	if parser.loopDepth == 0 {
+		// No need to synchronize as the parser is not in a confused state.
+		parser.error(keyword, "Can't use '"+keyword.Lexeme+"' outside of a loop.")
+	}
+	parser.consume(TokenSemicolon, "Expect ';' after '"+keyword.Lexeme+"'.")
+
+	if keyword.Type == TokenBreak {
+		return Break{Keyword: keyword}
+	}
+	return Continue{Keyword: keyword}
+}
+
+func (parser *Parser) expressionStatement() Stmt {
+	expr := parser.expression()
+	// For quick scripts, the value of a final top-level expression without a semicolon is
+	// printed, like in the REPL.
+	if parser.isAtEnd() && parser.statementDepth == 1 && parser.functionDepth == 0 {
+		return Print{Expressions: []Expr{expr}}
+	}
+	parser.consume(TokenSemicolon, "Expect ';' after expression.")
+	return Expression{Expression: expr}
+}
+
 func (parser *Parser) expression() Expr {
 	return parser.comma()
 }
 
 func (parser *Parser) comma() Expr {
-	expr := parser.ternary()
+	expr := parser.assignment()
 
 	for parser.match(TokenComma) {
 		operator := parser.previous()
-		right := parser.ternary()
+		right := parser.assignment()
 		expr = Binary{
 			Left:     expr,
 			Operator: operator,
@@ -491,15 +1441,107 @@ func (parser *Parser) comma() Expr {
 	return expr
 }
 
+// maxNesting is the maximum depth of nested expressions. Parsing recurses for each level, so
+// without a limit deeply nested expressions would exhaust the stack.
+const maxNesting = 512
+
+// nest enters a nested expression. The returned function must be called to leave it again.
+func (parser *Parser) nest() func() {
+	parser.nesting++
+	if parser.nesting > maxNesting {
+		parser.nesting--
+		panic(parser.error(parser.peek(), "Expression nesting too deep."))
+	}
+	return func() {
+		parser.nesting--
+	}
+}
+
+func (parser *Parser) assignment() Expr {
+	defer parser.nest()()
+	expr := parser.ternary()
+
+	if parser.match(TokenEqual) {
+		equals := parser.previous()
+		value := parser.assignment()
+
+		if variable, isVariable := expr.(Variable); isVariable {
+			return Assign{
+				Name:       variable.Name,
+				Value:      value,
+				Resolution: variable.Resolution,
+			}
+		} else if index, isIndex := expr.(Index); isIndex {
+			return SetIndex{
+				Object:  index.Object,
+				Bracket: index.Bracket,
+				Index:   index.Index,
+				Value:   value,
+			}
+		} else if get, isGet := expr.(Get); isGet {
+			return Set{
+				Object: get.Object,
+				Name:   get.Name,
+				Value:  value,
+			}
+		}
+
+		// No need to synchronize as the parser is not in a confused state.
+		parser.error(equals, "Invalid assignment target.")
+	} else if parser.match(TokenPlusEqual, TokenMinusEqual, TokenStarEqual, TokenSlashEqual) {
+		// Compound assignment is syntactic sugar, e.g. a += 1 is parsed as a = a + 1.
+		operator := parser.previous()
+		value := parser.assignment()
+
+		if variable, isVariable := expr.(Variable); isVariable {
+			return Assign{
+				Name: variable.Name,
+				Value: Binary{
+					Left:     variable,
+					Operator: compoundOperator(operator),
+					Right:    value,
+				},
+				Resolution: variable.Resolution,
+			}
+		}
+
+		// No need to synchronize as the parser is not in a confused state.
+		parser.error(operator, "Invalid assignment target.")
+	}
+	return expr
+}
+
+// compoundOperator converts a compound assignment operator to the binary operator it applies,
+// e.g. += to +. The position of the operator is kept for error reporting.
+func compoundOperator(operator Token) Token {
+	binary := operator
+	binary.Lexeme = operator.Lexeme[:len(operator.Lexeme)-1]
+	switch operator.Type {
+	case TokenPlusEqual:
+		binary.Type = TokenPlus
+	case TokenMinusEqual:
+		binary.Type = TokenMinus
+	case TokenStarEqual:
+		binary.Type = TokenStar
+	case TokenSlashEqual:
+		binary.Type = TokenSlash
+	}
+	return binary
+}
+
 func (parser *Parser) ternary() Expr {
-	expr := parser.equality()
+	expr := parser.binary(precedenceCoalesce)
 
+	// The false branch may itself be a ternary, which makes the operator right-associative:
+	// a ? b : c ? d : e is parsed as a ? b : (c ? d : e).
 	if parser.match(TokenQuestion) {
-		trueExpr := parser.expression()
-		parser.consume(TokenColon, "Expect colon.")
-		falseExpr := parser.expression()
+		question := parser.previous()
+		trueExpr := parser.assignment()
+		parser.consume(TokenColon, "Expect ':' after the true branch of the ternary operator.")
+		falseExpr := parser.ternary()
 		expr = Ternary{
 			Cond:        expr,
+			Question:    question,
 			TrueBranch:  trueExpr,
 			FalseBranch: falseExpr,
 		}
@@ -507,76 +1549,185 @@ func (parser *Parser) ternary() Expr {
 	return expr
 }
 
-func (parser *Parser) equality() Expr {
-	expr := parser.comparison()
-
-	for parser.match(TokenEqualEqual, TokenBangEqual) {
-		operator := parser.previous()
-		right := parser.comparison()
-		expr = Binary{
-			Left:     expr,
-			Operator: operator,
-			Right:    right,
+// interpolation parses a string with embedded expressions, whose first part has already
+// been consumed. The parts are TokenInterpolation tokens, each followed by an expression,
+// and a final TokenString, e.g. "a ${b} c" is INTERPOLATION "a ", b, STRING " c".
+func (parser *Parser) interpolation() Expr {
+	start := parser.previous()
+	var parts []Expr
+	for {
+		if text := parser.previous().Literal.(string); text != "" {
+			parts = append(parts, Literal{Value: String{V: text}})
+		}
+		if parser.previous().Type == TokenString {
+			return Interpolation{Start: start, Parts: parts}
+		}
+		parts = append(parts, parser.expression())
+		if !parser.match(TokenInterpolation, TokenString) {
+			panic(parser.error(parser.peek(), "Expect '}' after interpolated expression."))
 		}
 	}
-	return expr
 }
 
-func (parser *Parser) comparison() Expr {
-	expr := parser.addition()
+// precedence is the binding power of a binary operator. Operators with a higher precedence
+// bind tighter, e.g. a + b * c is parsed as a + (b * c).
+type precedence int
 
-	for parser.match(TokenGreater, TokenGreaterEqual, TokenLess, TokenLessEqual) {
-		operator := parser.previous()
-		right := parser.addition()
-		expr = Binary{
-			Left:     expr,
-			Operator: operator,
-			Right:    right,
-		}
-	}
-	return expr
+const (
+	precedenceCoalesce precedence = iota
+	precedenceOr
+	precedenceAnd
+	precedenceBitwise
+	precedenceEquality
+	precedenceComparison
+	precedenceAddition
+	precedenceMultiplication
+	precedencePower
+)
+
+// binaryOperator describes how a binary operator is parsed.
+type binaryOperator struct {
+	precedence precedence
+	// Whether a chain of the operator groups to the right, e.g. a ** b ** c is a ** (b ** c)
+	rightAssociative bool
+	// Whether a chain of operators of this precedence is an error, e.g. a < b < c
+	nonAssociative bool
+	// Whether the operator short-circuits, in which case it is parsed as a Logical expression
+	logical bool
 }
 
-func (parser *Parser) addition() Expr {
-	expr := parser.multiplication()
+// binaryOperators are the operators parsed by binary. The assignment, ternary, comma and
+// unary operators have their own parsing functions.
+var binaryOperators = map[TokenType]binaryOperator{
+	TokenQuestionQuestion: {precedence: precedenceCoalesce, logical: true},
+	TokenOr:               {precedence: precedenceOr, logical: true},
+	TokenAnd:              {precedence: precedenceAnd, logical: true},
+	TokenAmpersand:        {precedence: precedenceBitwise},
+	TokenPipe:             {precedence: precedenceBitwise},
+	TokenCaret:            {precedence: precedenceBitwise},
+	TokenEqualEqual:       {precedence: precedenceEquality},
+	TokenBangEqual:        {precedence: precedenceEquality},
+	TokenGreater:          {precedence: precedenceComparison, nonAssociative: true},
+	TokenGreaterEqual:     {precedence: precedenceComparison, nonAssociative: true},
+	TokenLess:             {precedence: precedenceComparison, nonAssociative: true},
+	TokenLessEqual:        {precedence: precedenceComparison, nonAssociative: true},
+	TokenPlus:             {precedence: precedenceAddition},
+	TokenMinus:            {precedence: precedenceAddition},
+	TokenStar:             {precedence: precedenceMultiplication},
+	TokenSlash:            {precedence: precedenceMultiplication},
+	TokenDiv:              {precedence: precedenceMultiplication},
+	// ** binds tighter than a unary operator on its left, e.g. -2 ** 2 is -(2 ** 2).
+	TokenStarStar: {precedence: precedencePower, rightAssociative: true},
+}
 
-	for parser.match(TokenMinus, TokenPlus) {
-		operator := parser.previous()
-		right := parser.multiplication()
-		expr = Binary{
-			Left:     expr,
-			Operator: operator,
-			Right:    right,
-		}
+// operandPrecedence is the lowest precedence of the operators that may appear in the right
+// operand of the operator without parentheses.
+func (operator binaryOperator) operandPrecedence() precedence {
+	if operator.rightAssociative {
+		return operator.precedence
 	}
-	return expr
+	return operator.precedence + 1
 }
 
-func (parser *Parser) multiplication() Expr {
+// binary parses a chain of binary operators whose precedence is at least minPrecedence, by
+// precedence climbing.
+func (parser *Parser) binary(minPrecedence precedence) Expr {
 	expr := parser.unary()
 
-	for parser.match(TokenStar, TokenSlash) {
-		operator := parser.previous()
-		right := parser.unary()
-		expr = Binary{
-			Left:     expr,
-			Operator: operator,
-			Right:    right,
+	chained := false // Whether a chain of non-associative operators has been reported
+	for {
+		operator, isBinary := binaryOperators[parser.peek().Type]
+		if !isBinary || operator.precedence < minPrecedence {
+			return expr
+		}
+		token := parser.advance()
+		right := parser.binary(operator.operandPrecedence())
+		if next, isBinary := binaryOperators[parser.peek().Type]; isBinary && operator.nonAssociative && next.precedence == operator.precedence && !chained {
+			// E.g. 1 < 2 < 3 would compare the boolean 1 < 2 to 3. No need to synchronize as
+			// the parser is not in a confused state.
+			parser.error(parser.peek(), "Chained comparison is not supported; use 'and'.")
+			chained = true
+		}
+		if operator.logical {
+			expr = Logical{
+				Left:     expr,
+				Operator: token,
+				Right:    right,
+			}
+		} else {
+			expr = Binary{
+				Left:     expr,
+				Operator: token,
+				Right:    right,
+			}
 		}
 	}
-	return expr
 }
 
 func (parser *Parser) unary() Expr {
-	if parser.match(TokenBang, TokenMinus) {
+	defer parser.nest()()
+	if parser.match(TokenBang, TokenMinus, TokenTilde) {
 		operator := parser.previous()
-		right := parser.unary()
+		// The operand may contain operators that bind tighter than unary operators, i.e. **.
+		right := parser.binary(precedencePower)
 		return Unary{
 			Operator: operator,
 			Right:    right,
 		}
 	}
-	return parser.primary()
+	return parser.call()
+}
+
+func (parser *Parser) call() Expr {
+	expr := parser.primary()
+
+	for {
+		if parser.match(TokenLeftParen) {
+			expr = parser.finishCall(expr)
+		} else if parser.match(TokenLeftBracket) {
+			index := parser.expression()
+			bracket := parser.consume(TokenRightBracket, "Expect ']' after index.")
+			expr = Index{
+				Object:  expr,
+				Bracket: bracket,
+				Index:   index,
+			}
+		} else if parser.match(TokenDot) {
+			name := parser.consume(TokenIdentifier, "Expect property name after '.'.")
+			expr = Get{
+				Object: expr,
+				Name:   name,
+			}
+		} else {
+			break
+		}
+	}
+	return expr
+}
+
+// finishCall parses the arguments of a call. Arguments are parsed below the comma
+// operator so that each comma separates two arguments.
+func (parser *Parser) finishCall(callee Expr) Expr {
+	var arguments []Expr
+	if !parser.check(TokenRightParen) {
+		for {
+			if len(arguments) >= maxArguments {
+				parser.error(parser.peek(), fmt.Sprintf("Can't have more than %d arguments.", maxArguments))
+			}
+			arguments = append(arguments, parser.assignment())
+			// A trailing comma is allowed, e.g. f(a, b,).
+			if !parser.match(TokenComma) || parser.check(TokenRightParen) {
+				break
+			}
+		}
+	}
+
+	paren := parser.consume(TokenRightParen, "Expect ')' after arguments.")
+	return Call{
+		Callee:    callee,
+		Paren:     paren,
+		Arguments: arguments,
+	}
 }
 
 func (parser *Parser) primary() Expr {
@@ -595,12 +1746,69 @@ func (parser *Parser) primary() Expr {
 	}
 
 	if parser.match(TokenNumber) {
-		return Literal{Value: parser.previous().Literal.(Number)}
+		// A Number or an Integer.
+		return Literal{Value: parser.previous().Literal.(fmt.Stringer)}
 	}
 
 	if parser.match(TokenString) {
 		return Literal{Value: String{V: parser.previous().Literal.(string)}}
 	}
+	if parser.match(TokenInterpolation) {
+		return parser.interpolation()
+	}
+
+	if parser.match(TokenThis) {
+		keyword := parser.previous()
+		if parser.classDepth == 0 {
+			// No need to synchronize as the parser is not in a confused state.
+			parser.error(keyword, "Can't use 'this' outside of a class.")
+		}
+		return This{Keyword: keyword, Resolution: &Resolution{}}
+	}
+
+	if parser.match(TokenSuper) {
+		keyword := parser.previous()
+		if parser.classDepth == 0 {
+			// No need to synchronize as the parser is not in a confused state.
+			parser.error(keyword, "Can't use 'super' outside of a class.")
+		} else if !parser.inSubclass {
+			parser.error(keyword, "Can't use 'super' in a class with no superclass.")
+		}
+		parser.consume(TokenDot, "Expect '.' after 'super'.")
+		method := parser.consume(TokenIdentifier, "Expect superclass method name.")
+		return Super{
+			Keyword:    keyword,
+			Method:     method,
+			Resolution: &Resolution{},
+		}
+	}
+
+	if parser.match(TokenIdentifier) {
+		return Variable{Name: parser.previous(), Resolution: &Resolution{}}
+	}
+
+	if parser.match(TokenFun) {
+		keyword := parser.previous()
+		parser.consume(TokenLeftParen, "Expect '(' after 'fun'.")
+		params, body := parser.functionBody("function", false)
+		// The keyword stands in for the name, e.g. for the position of errors.
+		return Lambda{
+			Declaration: Function{
+				Name:   keyword,
+				Params: params,
+				Body:   body,
+			},
+		}
+	}
+
+	if parser.match(TokenLeftBracket) {
+		return parser.list()
+	}
+
+	// A brace in an expression starts a map. Blocks are only parsed as statements.
+	if parser.match(TokenLeftBrace) {
+		return parser.mapLiteral()
+	}
 
 	if parser.match(TokenLeftParen) {
 		expr := parser.expression()
@@ -608,9 +1816,63 @@ func (parser *Parser) primary() Expr {
 		return Grouping{Expression: expr}
 	}
 
+	// Error production: a binary operator without a left-hand operand. The right-hand operand
+	// is parsed, and discarded, so that the parser isn't confused by it. A leading - is a
+	// unary operator, and and or are left to be reported as unexpected.
+	if operator, isBinary := binaryOperators[parser.peek().Type]; isBinary && !operator.logical {
+		parser.error(parser.advance(), "Binary operator requires a left-hand operand.")
+		parser.binary(operator.operandPrecedence())
+		return Literal{Value: nil}
+	}
+
 	panic(parser.error(parser.peek(), "Expect expression."))
 }
 
+// list parses the elements of a list literal. The opening bracket has already been consumed.
+func (parser *Parser) list() Expr {
+	bracket := parser.previous()
+	var elements []Expr
+	if !parser.check(TokenRightBracket) {
+		for {
+			elements = append(elements, parser.assignment())
+			// A trailing comma is allowed, e.g. [1, 2,].
+			if !parser.match(TokenComma) || parser.check(TokenRightBracket) {
+				break
+			}
+		}
+	}
+
+	parser.consume(TokenRightBracket, "Expect ']' after list elements.")
+	return List{
+		Bracket:  bracket,
+		Elements: elements,
+	}
+}
+
+// mapLiteral parses the entries of a map literal. The opening brace has already been consumed.
+func (parser *Parser) mapLiteral() Expr {
+	brace := parser.previous()
+	var keys, values []Expr
+	if !parser.check(TokenRightBrace) {
+		for {
+			keys = append(keys, parser.assignment())
+			parser.consume(TokenColon, "Expect ':' after map key.")
+			values = append(values, parser.assignment())
+			// A trailing comma is allowed, e.g. {"a": 1,}.
+			if !parser.match(TokenComma) || parser.check(TokenRightBrace) {
+				break
+			}
+		}
+	}
+
+	parser.consume(TokenRightBrace, "Expect '}' after map entries.")
+	return Map{
+		Brace:  brace,
+		Keys:   keys,
+		Values: values,
+	}
+}
+
 // Parsing infrastructure.
 
 func (parser *Parser) match(tokenTypes ...TokenType) bool {
@@ -630,6 +1892,14 @@ func (parser *Parser) check(tokenType TokenType) bool {
 	return parser.peek().Type == tokenType
 }
 
+// checkNext is like check, but for the token after the current one.
+func (parser *Parser) checkNext(tokenType TokenType) bool {
+	if parser.isAtEnd() || parser.tokens[parser.current+1].Type == TokenEof {
+		return false
+	}
+	return parser.tokens[parser.current+1].Type == tokenType
+}
+
 func (parser *Parser) advance() Token {
 	if !parser.isAtEnd() {
 		parser.current++
@@ -651,7 +1921,10 @@ func (parser *Parser) previous() Token {
 
 // Error recovery infrastructure.
 
-// Sentinel error used to unwind the parser.
+// parseError is panicked with to unwind the parser after a syntax error, which has already
+// been reported by Parser.error. Only the functions that recover to carry on parsing, i.e.
+// declaration and ParseExpression, may recover it. Any other panic is a bug and must not be
+// recovered by them.
 type parseError struct {
 }
 
@@ -659,10 +1932,6 @@ func (p parseError) Error() string {
 	return "Parse error"
 }
 
-func (p parseError) RuntimeError() {
-	panic("implement me")
-}
-
 func (parser *Parser) consume(tokenType TokenType, msg string) Token {
 	if parser.check(tokenType) {
 		return parser.advance()
@@ -672,10 +1941,14 @@ func (parser *Parser) consume(tokenType TokenType, msg string) Token {
 }
 
 func (parser *Parser) error(token Token, msg string) parseError {
+	if !parser.hadError && token.Type == TokenEof {
+		parser.unfinished = true
+	}
+	parser.hadError = true
 	if token.Type == TokenEof {
-		parser.reporter.Report(token.Line, " at end", msg)
+		parser.reporter.Report(token.Line, token.Column, " at end", msg)
 	} else {
-		parser.reporter.Report(token.Line, " at '"+token.Lexeme+"'", msg)
+		parser.reporter.Report(token.Line, token.Column, " at '"+token.Lexeme+"'", msg)
 	}
 	return parseError{}
 }
@@ -692,14 +1965,8 @@ func (parser *Parser) synchronize() {
 		}
 
 		switch parser.peek().Type {
-		case TokenClass:
-		case TokenFun:
-		case TokenVar:
-		case TokenFor:
-		case TokenIf:
-		case TokenWhile:
-		case TokenPrint:
-		case TokenReturn:
+		case TokenClass, TokenFun, TokenVar, TokenFor, TokenIf, TokenWhile, TokenPrint, TokenReturn,
+			TokenBreak, TokenContinue, TokenSwitch, TokenDo:
 			return
 		}
 
@@ -712,6 +1979,10 @@ func (parser *Parser) synchronize() {
 type Frontend struct {
 	source   []byte
 	reporter ErrorReporter
+
+	// How long scanning and parsing took the last time the source was parsed.
+	ScanTime  time.Duration
+	ParseTime time.Duration
 }
 
 func NewFrontend(source []byte, reporter ErrorReporter) Frontend {
@@ -721,10 +1992,78 @@ func NewFrontend(source []byte, reporter ErrorReporter) Frontend {
 	}
 }
 
-func (frontend *Frontend) Parse() Expr {
-	scanner := NewScanner(frontend.source, frontend.reporter)
+// ParseExpression parses the source as a single expression. Errors are not reported, instead
+// nil is returned if the source is not a valid expression. This allows the caller to fall
+// back to parsing the source as statements.
+func (frontend *Frontend) ParseExpression() Expr {
+	reporter := CollectingErrorReporter{}
+	tokens, _ := frontend.scan(&reporter)
+	start := time.Now()
+	parser := NewParser(tokens, &reporter)
+	expr, e := parser.ParseExpression()
+	frontend.ParseTime = time.Since(start)
+	if e != nil || len(reporter.Errors()) > 0 {
+		return nil
+	}
+	return expr
+}
+
+// IsIncomplete reports whether the source is unfinished code that may become valid once
+// more code is added, e.g. a block that has not been closed yet. Errors are not reported.
+func (frontend *Frontend) IsIncomplete() bool {
+	if frontend.ParseExpression() != nil {
+		return false
+	}
+
+	reporter := CollectingErrorReporter{}
+	scanner := NewScanner(frontend.source, &reporter)
 	tokens := scanner.ScanTokens()
+	if scanner.unterminated {
+		return true
+	}
+	parser := NewParser(tokens, &reporter)
+	_, _ = parser.Parse()
+	return parser.unfinished
+}
+
+func (frontend *Frontend) Parse() []Stmt {
+	statements, _, _ := frontend.parse()
+	return statements
+}
+
+// ParseChecked parses the source like Parse and also returns an error if the source has
+// lexical or syntax errors. The errors themselves are reported to the error reporter.
+func (frontend *Frontend) ParseChecked() ([]Stmt, error) {
+	statements, _, e := frontend.parse()
+	return statements, e
+}
+
+// ParseWithTokens parses the source like Parse and also returns the scanned tokens, e.g.
+// for syntax highlighting, so that they don't have to be scanned again.
+func (frontend *Frontend) ParseWithTokens() ([]Stmt, []Token) {
+	statements, tokens, _ := frontend.parse()
+	return statements, tokens
+}
+
+func (frontend *Frontend) parse() ([]Stmt, []Token, error) {
+	tokens, scanError := frontend.scan(frontend.reporter)
+	start := time.Now()
 	parser := NewParser(tokens, frontend.reporter)
-	expr, _ := parser.Parse()
-	return expr
+	statements, e := parser.Parse()
+	frontend.ParseTime = time.Since(start)
+	if scanError != nil {
+		e = scanError
+	}
+	return statements, tokens, e
+}
+
+func (frontend *Frontend) scan(reporter ErrorReporter) ([]Token, error) {
+	start := time.Now()
+	scanner := NewScanner(frontend.source, reporter)
+	tokens := scanner.ScanTokens()
+	frontend.ScanTime = time.Since(start)
+	if scanner.hadError {
+		return tokens, errors.New("failed to scan")
+	}
+	return tokens, nil
 }
@@ -0,0 +1,804 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTokenOffsetsRoundTrip(t *testing.T) {
+	source := []byte("\"a string\" >= 12.5 // comment\n!= \"multi\nline\"")
+	reporter := StateErrorReporter{}
+	scanner := NewScanner(source, &reporter)
+	tokens := scanner.ScanTokens()
+	if reporter.HadError {
+		t.Fatal("unexpected scanning error")
+	}
+
+	expected := []string{"\"a string\"", ">=", "12.5", "!=", "\"multi\nline\"", ""}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d", len(expected), len(tokens))
+	}
+	for i, token := range tokens {
+		if text := string(source[token.StartOffset:token.EndOffset]); text != expected[i] {
+			t.Errorf("token %d: expected source text %q, got %q", i, expected[i], text)
+		}
+	}
+}
+
+func TestScanChannel(t *testing.T) {
+	source := []byte("var a = \"é\" + 1.5; // comment\nprint a;")
+	scanner := NewScanner(source, &CollectingErrorReporter{})
+	expected := scanner.ScanTokens()
+
+	scanner = NewScanner(source, &CollectingErrorReporter{})
+	var tokens []Token
+	for token := range scanner.ScanChannel() {
+		tokens = append(tokens, token)
+	}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d", len(expected), len(tokens))
+	}
+	for i := range tokens {
+		if tokens[i] != expected[i] {
+			t.Errorf("expected token %d to be %v, got %v", i, expected[i], tokens[i])
+		}
+	}
+	if last := tokens[len(tokens)-1]; last.Type != TokenEof {
+		t.Errorf("expected the last token to be EOF, got %v", last)
+	}
+}
+
+func TestTabWidth(t *testing.T) {
+	source := []byte("{\n\tprint a;\n  \tprint\tb;\n}")
+	tests := map[int][]int{
+		// The columns of a and b.
+		1: {8, 10},
+		4: {11, 13},
+		8: {15, 17},
+	}
+	for tabWidth, expected := range tests {
+		scanner := NewScanner(source, &CollectingErrorReporter{})
+		scanner.TabWidth = tabWidth
+		var columns []int
+		for _, token := range scanner.ScanTokens() {
+			if token.Type == TokenIdentifier {
+				columns = append(columns, token.Column)
+			}
+		}
+		if len(columns) != 2 || columns[0] != expected[0] || columns[1] != expected[1] {
+			t.Errorf("tab width %d: expected columns %v, got %v", tabWidth, expected, columns)
+		}
+	}
+}
+
+func TestCRLFLineEndings(t *testing.T) {
+	source := []byte("var a = \"multi\r\nline\";\r\nvar b = \"\\r\\n\";\r\nprint a;\r\n")
+	reporter := CollectingErrorReporter{}
+	scanner := NewScanner(source, &reporter)
+	tokens := scanner.ScanTokens()
+	if len(reporter.Errors()) > 0 {
+		t.Fatalf("unexpected errors %v", reporter.Errors())
+	}
+
+	var strs []interface{}
+	for _, token := range tokens {
+		if token.Type == TokenString {
+			strs = append(strs, token.Literal)
+		}
+	}
+	if len(strs) != 2 || strs[0] != "multi\nline" || strs[1] != "\r\n" {
+		t.Errorf("unexpected string literals %q", strs)
+	}
+	if print := tokens[len(tokens)-4]; print.Type != TokenPrint || print.Line != 4 || print.Column != 1 {
+		t.Errorf("expected print at line 4, column 1, got %v at line %d, column %d", print, print.Line, print.Column)
+	}
+}
+
+// The EOF token follows the last token, so errors at the end point just past the code
+// rather than at trailing whitespace or comments.
+func TestEofPosition(t *testing.T) {
+	for _, source := range []string{
+		"print (1 + 2",
+		"print (1 + 2\n",
+		"print (1 + 2 // unfinished\n\n",
+	} {
+		reporter := CollectingErrorReporter{}
+		frontend := NewFrontend([]byte(source), &reporter)
+		frontend.Parse()
+
+		errors := reporter.Errors()
+		if len(errors) != 1 || errors[0].Message != "Expect ')' after expression." {
+			t.Errorf("unexpected errors %v for %q", errors, source)
+		} else if errors[0].Line != 1 || errors[0].Column != 13 {
+			t.Errorf("expected the error for %q at line 1, column 13, got line %d, column %d",
+				source, errors[0].Line, errors[0].Column)
+		}
+	}
+
+	scanner := NewScanner([]byte("  \n"), &CollectingErrorReporter{})
+	if eof := scanner.ScanTokens()[0]; eof.Type != TokenEof || eof.Line != 1 || eof.Column != 1 {
+		t.Errorf("expected EOF at line 1, column 1 without tokens, got line %d, column %d", eof.Line, eof.Column)
+	}
+}
+
+func TestFinalExpressionWithoutSemicolon(t *testing.T) {
+	reporter := CollectingErrorReporter{}
+	frontend := NewFrontend([]byte("var a = 1;\na + 1"), &reporter)
+	statements := frontend.Parse()
+	if errors := reporter.Errors(); len(errors) > 0 {
+		t.Fatalf("unexpected errors %v", errors)
+	}
+	if printed := (AstPrinter{}).Print(statements); printed != "(var a 1)\n(print (+ a 1))" {
+		t.Errorf("expected the final expression to be printed, got %s", printed)
+	}
+
+	// Only a top-level expression may omit its semicolon.
+	for _, source := range []string{"1 + 2; 3 4", "if (true) 1", "{ 1 }", "fun f() { 1 }"} {
+		reporter := CollectingErrorReporter{}
+		frontend := NewFrontend([]byte(source), &reporter)
+		frontend.Parse()
+		if len(reporter.Errors()) == 0 {
+			t.Errorf("expected a syntax error for %s", source)
+		}
+	}
+}
+
+func TestRawStrings(t *testing.T) {
+	tests := map[string]string{
+		"`C:\\temp`":      `C:\temp`,
+		"`\\d+\\.\\d*`":   `\d+\.\d*`,
+		"`say \"hi\"\\n`": `say "hi"\n`,
+		"`multi\nline`":   "multi\nline",
+		"`multi\r\nline`": "multi\nline",
+		"`\\u{41}`":       `\u{41}`,
+	}
+	for source, expected := range tests {
+		reporter := CollectingErrorReporter{}
+		scanner := NewScanner([]byte(source), &reporter)
+		tokens := scanner.ScanTokens()
+		if errors := reporter.Errors(); len(errors) > 0 {
+			t.Errorf("unexpected errors %v for %s", errors, source)
+		} else if tokens[0].Type != TokenString || tokens[0].Literal != expected {
+			t.Errorf("expected the string %q for %s, got %v", expected, source, tokens[0])
+		}
+	}
+
+	scanner := NewScanner([]byte("`multi\nline`\nprint"), &CollectingErrorReporter{})
+	if print := scanner.ScanTokens()[1]; print.Type != TokenPrint || print.Line != 3 {
+		t.Errorf("expected newlines in raw strings to be counted, got %v on line %d", print, print.Line)
+	}
+
+	reporter := CollectingErrorReporter{}
+	scanner = NewScanner([]byte("print `abc\\;"), &reporter)
+	scanner.ScanTokens()
+	if errors := reporter.Errors(); len(errors) != 1 || errors[0].Error() != "[line 1, col 7] Error: Unterminated string." {
+		t.Errorf("unexpected errors %v", errors)
+	}
+}
+
+func TestBlockComments(t *testing.T) {
+	tests := map[string][]TokenType{
+		"/* a */ print":                      {TokenPrint, TokenEof},
+		"/* a /* b */ c */ print":            {TokenPrint, TokenEof},
+		"/* /* /* deep */ */ */ 1 /* */ + 2": {TokenNumber, TokenPlus, TokenNumber, TokenEof},
+		"/**/ a /*/ b */ c":                  {TokenIdentifier, TokenIdentifier, TokenEof},
+		"a / /* b */ c * /* d */ e":          {TokenIdentifier, TokenSlash, TokenIdentifier, TokenStar, TokenIdentifier, TokenEof},
+	}
+	for source, expected := range tests {
+		reporter := CollectingErrorReporter{}
+		scanner := NewScanner([]byte(source), &reporter)
+		tokens := scanner.ScanTokens()
+		if errors := reporter.Errors(); len(errors) > 0 {
+			t.Errorf("unexpected errors %v for %s", errors, source)
+			continue
+		}
+		types := make([]TokenType, len(tokens))
+		for i, token := range tokens {
+			types[i] = token.Type
+		}
+		if fmt.Sprint(types) != fmt.Sprint(expected) {
+			t.Errorf("expected the tokens %v for %s, got %v", expected, source, types)
+		}
+	}
+
+	scanner := NewScanner([]byte("/* a\n/* b\n*/\n*/ print"), &CollectingErrorReporter{})
+	if print := scanner.ScanTokens()[0]; print.Type != TokenPrint || print.Line != 4 || print.Column != 4 {
+		t.Errorf("expected newlines in nested comments to be counted, got %v at %d:%d", print, print.Line, print.Column)
+	}
+
+	for source, expected := range map[string]string{
+		"print 1; /* a":           "[line 1, col 14] Error: Unterminated block comment.",
+		"/* a /* b */":            "[line 1, col 13] Error: Unterminated block comment.",
+		"/* a\n/* b */\nprint 1;": "[line 3, col 9] Error: Unterminated block comment.",
+	} {
+		reporter := CollectingErrorReporter{}
+		scanner := NewScanner([]byte(source), &reporter)
+		scanner.ScanTokens()
+		if errors := reporter.Errors(); len(errors) != 1 || errors[0].Error() != expected {
+			t.Errorf("expected the error %q for %q, got %v", expected, source, errors)
+		}
+	}
+}
+
+func TestRadixNumbers(t *testing.T) {
+	valid := map[string]interface{}{
+		"0x1F":                Integer{V: 31},
+		"0XfF":                Integer{V: 255},
+		"0b101":               Integer{V: 5},
+		"0B0":                 Integer{V: 0},
+		"0x10000000000000000": Number{V: 18446744073709551616},
+	}
+	for source, expected := range valid {
+		reporter := CollectingErrorReporter{}
+		scanner := NewScanner([]byte(source), &reporter)
+		tokens := scanner.ScanTokens()
+		if errors := reporter.Errors(); len(errors) > 0 {
+			t.Errorf("unexpected errors %v for %s", errors, source)
+		} else if tokens[0].Type != TokenNumber || tokens[0].Literal != expected {
+			t.Errorf("expected the number %v for %s, got %v", expected, source, tokens[0])
+		}
+	}
+
+	// A malformed literal is reported once, and not as a missing expression too.
+	for _, literal := range []string{"0x", "0xG", "0b102", "0b", "0x1g"} {
+		reporter := CollectingErrorReporter{}
+		frontend := NewFrontend([]byte("print "+literal+";"), &reporter)
+		frontend.Parse()
+		expected := fmt.Sprintf("Invalid number literal '%s'.", literal)
+		if errors := reporter.Errors(); len(errors) != 1 || errors[0].Message != expected || errors[0].Column != 7 {
+			t.Errorf("expected only the error %q at column 7 for %s, got %v", expected, literal, errors)
+		}
+	}
+}
+
+func TestUnicodeEscapes(t *testing.T) {
+	valid := map[string]string{
+		`"\u0041"`:        "A",
+		`"\u00e9t\u00E9"`: "été",
+		`"\u{1F600}"`:     "😀",
+		`"\u{41}\u{0}"`:   "A\x00",
+		`"\u{10FFFF}"`:    "\U0010FFFF",
+		`"\uD83D\uDE00"`:  "😀",
+		`"\ud83d\ude00!"`: "😀!",
+	}
+	for source, expected := range valid {
+		reporter := CollectingErrorReporter{}
+		scanner := NewScanner([]byte(source), &reporter)
+		tokens := scanner.ScanTokens()
+		if errors := reporter.Errors(); len(errors) > 0 {
+			t.Errorf("unexpected errors %v for %s", errors, source)
+		} else if tokens[0].Type != TokenString || tokens[0].Literal != expected {
+			t.Errorf("expected the string %q for %s, got %v", expected, source, tokens[0])
+		}
+	}
+
+	invalid := map[string]string{
+		`"\uD83D"`:        "Invalid unicode escape: unpaired surrogate.",
+		`"\uDE00"`:        "Invalid unicode escape: unpaired surrogate.",
+		`"\uD83D\u0041"`:  "Invalid unicode escape: unpaired surrogate.",
+		`"\uD83Dx"`:       "Invalid unicode escape: unpaired surrogate.",
+		`"\u{D800}"`:      "Invalid unicode escape: unpaired surrogate.",
+		`"\u{110000}"`:    "Invalid unicode escape: expected 1 to 6 hex digits up to 10FFFF in \\u{...}.",
+		`"\u{FFFFFFFFF}"`: "Invalid unicode escape: expected 1 to 6 hex digits up to 10FFFF in \\u{...}.",
+		`"\u{}"`:          "Invalid unicode escape: expected 1 to 6 hex digits up to 10FFFF in \\u{...}.",
+		`"\u{41"`:         "Invalid unicode escape: expected 1 to 6 hex digits up to 10FFFF in \\u{...}.",
+		`"\u12"`:          "Invalid unicode escape: expected 4 hex digits after \\u.",
+		`"\u12G4"`:        "Invalid unicode escape: expected 4 hex digits after \\u.",
+		`"\uD83D\u12"`:    "Invalid unicode escape: expected 4 hex digits after \\u.",
+	}
+	for source, expected := range invalid {
+		reporter := CollectingErrorReporter{}
+		scanner := NewScanner([]byte(source), &reporter)
+		scanner.ScanTokens()
+		if errors := reporter.Errors(); len(errors) == 0 || errors[0].Message != expected {
+			t.Errorf("expected the error %q for %s, got %v", expected, source, errors)
+		}
+	}
+}
+
+// An unterminated string is cut off at the end of its line, so that the code that follows
+// is still scanned and its errors are reported too.
+func TestUnterminatedString(t *testing.T) {
+	tests := []struct {
+		source string
+		types  []TokenType
+		errors []string
+	}{
+		{
+			"var a = \"abc\nprint 1 @;\n",
+			[]TokenType{TokenVar, TokenIdentifier, TokenEqual, TokenString, TokenPrint, TokenNumber, TokenSemicolon, TokenEof},
+			[]string{"[line 1, col 9] Error: Unterminated string.", "[line 2, col 9] Error: Unexpected character '@' (U+0040)."},
+		},
+		{
+			"print \"abc",
+			[]TokenType{TokenPrint, TokenString, TokenEof},
+			[]string{"[line 1, col 7] Error: Unterminated string."},
+		},
+		{
+			"1 /* abc\n2",
+			[]TokenType{TokenNumber, TokenEof},
+			[]string{"[line 2, col 2] Error: Unterminated block comment."},
+		},
+	}
+	for _, test := range tests {
+		reporter := CollectingErrorReporter{}
+		scanner := NewScanner([]byte(test.source), &reporter)
+		tokens := scanner.ScanTokens()
+
+		var types []TokenType
+		for _, token := range tokens {
+			types = append(types, token.Type)
+		}
+		if fmt.Sprint(types) != fmt.Sprint(test.types) {
+			t.Errorf("expected tokens %v for %q, got %v", test.types, test.source, types)
+		}
+		var errors []string
+		for _, e := range reporter.Errors() {
+			errors = append(errors, e.Error())
+		}
+		if fmt.Sprint(errors) != fmt.Sprint(test.errors) {
+			t.Errorf("expected errors %q for %q, got %q", test.errors, test.source, errors)
+		}
+	}
+
+	scanner := NewScanner([]byte("\"abc\r\ndef"), &CollectingErrorReporter{})
+	if str := scanner.ScanTokens()[0]; str.Literal != "abc" || str.Lexeme != "\"abc" {
+		t.Errorf("expected the string to be cut off at the end of the line, got %q", str.Lexeme)
+	}
+}
+
+func TestKeepComments(t *testing.T) {
+	source := "// Adds one.\n// Really.\nfun inc(x) {\n  return x + 1; // trailing\n}\n/* block\n   comment */ inc(1);\n// end\n"
+	scanner := NewScanner([]byte(source), &CollectingErrorReporter{})
+	scanner.KeepComments = true
+	tokens := scanner.ScanTokens()
+
+	type comment struct {
+		text string
+		line int
+	}
+	expected := map[string][]comment{
+		"fun": {{"Adds one.", 1}, {"Really.", 2}},
+		"}":   {{"trailing", 4}},
+		"inc": {{"block\n   comment", 6}},
+		"":    {{"end", 8}},
+	}
+	found := 0
+	for _, token := range tokens {
+		comments := scanner.CommentsBefore(token)
+		if len(comments) == 0 {
+			continue
+		}
+		found++
+		var actual []comment
+		for _, c := range comments {
+			if c.Type != TokenComment {
+				t.Errorf("expected a comment token, got %v", c)
+			}
+			actual = append(actual, comment{c.Literal.(string), c.Line})
+		}
+		if fmt.Sprint(actual) != fmt.Sprint(expected[token.Lexeme]) {
+			t.Errorf("expected comments %v before %v, got %v", expected[token.Lexeme], token, actual)
+		}
+	}
+	if found != len(expected) {
+		t.Errorf("expected comments before %d tokens, got %d", len(expected), found)
+	}
+
+	// The comments don't change the tokens, and are dropped by default.
+	plain := NewScanner([]byte(source), &CollectingErrorReporter{})
+	if plainTokens := plain.ScanTokens(); fmt.Sprint(plainTokens) != fmt.Sprint(tokens) {
+		t.Errorf("expected the same tokens with and without comments")
+	} else if comments := plain.CommentsBefore(plainTokens[0]); comments != nil {
+		t.Errorf("expected no comments by default, got %v", comments)
+	}
+}
+
+func TestUnexpectedCharacter(t *testing.T) {
+	tests := map[string]string{
+		"var a = @;":  "[line 1, col 9] Error: Unexpected character '@' (U+0040).",
+		"print 1;\n#": "[line 2, col 1] Error: Unexpected character '#' (U+0023).",
+		"\x01":        "[line 1, col 1] Error: Unexpected character '\\x01' (U+0001).",
+	}
+	for source, expected := range tests {
+		reporter := CollectingErrorReporter{}
+		scanner := NewScanner([]byte(source), &reporter)
+		scanner.ScanTokens()
+		if errors := reporter.Errors(); len(errors) != 1 || errors[0].Error() != expected {
+			t.Errorf("expected %q for %q, got %v", expected, source, errors)
+		}
+	}
+}
+
+func TestBinaryInput(t *testing.T) {
+	blob := []byte{0x7f, 'E', 'L', 'F', 2, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0x3e, 0, 1, 0, 0, 0, 0xc8, 0xff}
+	reporter := CollectingErrorReporter{}
+	scanner := NewScanner(blob, &reporter)
+	tokens := scanner.ScanTokens()
+
+	errors := reporter.Errors()
+	if len(errors) != 1 || errors[0].Message != "Input does not look like text." {
+		t.Errorf("expected a single error for binary input, got %v", errors)
+	}
+	if len(tokens) != 1 || tokens[0].Type != TokenEof {
+		t.Errorf("expected only EOF for binary input, got %v", tokens)
+	}
+}
+
+func TestParseChecked(t *testing.T) {
+	tests := map[string]bool{
+		"print 1;":      false,
+		"print 1 +;":    true,
+		"print \"a;":    true,
+		"print 1; @":    true,
+		"var a = 1, b;": false,
+	}
+	for source, fails := range tests {
+		reporter := CollectingErrorReporter{}
+		frontend := NewFrontend([]byte(source), &reporter)
+		statements, e := frontend.ParseChecked()
+		if fails && (e == nil || len(reporter.Errors()) == 0) {
+			t.Errorf("expected an error for %s", source)
+		} else if !fails && (e != nil || len(statements) == 0) {
+			t.Errorf("unexpected error %v for %s", e, source)
+		}
+	}
+}
+
+func TestParseWithTokens(t *testing.T) {
+	source := []byte("var a = 1;\nprint a + 2; // done")
+	scanner := NewScanner(source, &CollectingErrorReporter{})
+	expected := scanner.ScanTokens()
+
+	reporter := CollectingErrorReporter{}
+	frontend := NewFrontend(source, &reporter)
+	statements, tokens := frontend.ParseWithTokens()
+	if len(reporter.Errors()) > 0 || len(statements) != 2 {
+		t.Fatalf("expected 2 statements without errors, got %v (errors: %v)", statements, reporter.Errors())
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d", len(expected), len(tokens))
+	}
+	for i := range tokens {
+		if tokens[i] != expected[i] {
+			t.Errorf("expected token %d to be %v, got %v", i, expected[i], tokens[i])
+		}
+	}
+}
+
+// bugReporter panics when an error is reported, like a bug in the parser would.
+type bugReporter struct {
+	CollectingErrorReporter
+}
+
+func (reporter *bugReporter) Report(line int, column int, where string, msg string) {
+	panic("bug")
+}
+
+func TestParserDoesNotRecoverBugs(t *testing.T) {
+	parse := map[string]func(parser Parser){
+		"Parse": func(parser Parser) {
+			_, _ = parser.Parse()
+		},
+		"ParseExpression": func(parser Parser) {
+			_, _ = parser.ParseExpression()
+		},
+	}
+	for name, parse := range parse {
+		func() {
+			defer func() {
+				if r := recover(); r != "bug" {
+					t.Errorf("expected %s to panic with the bug, got %v", name, r)
+				}
+			}()
+			scanner := NewScanner([]byte("1 +"), &CollectingErrorReporter{})
+			parse(NewParser(scanner.ScanTokens(), &bugReporter{}))
+		}()
+	}
+}
+
+func TestParserReportsAllErrors(t *testing.T) {
+	source := []byte(`
+var = 1;
+print ;
+{ 1 + ; }
+print "this statement is fine";
+`)
+	reporter := StateErrorReporter{}
+	frontend := NewFrontend(source, &reporter)
+	statements := frontend.Parse()
+
+	if reporter.ErrorCount != 3 {
+		t.Errorf("expected 3 reported errors, got %d", reporter.ErrorCount)
+	}
+	// The valid statements around the errors are still parsed.
+	if len(statements) != 2 {
+		t.Errorf("expected 2 statements to be parsed, got %d", len(statements))
+	}
+}
+
+func TestTokenTypeNames(t *testing.T) {
+	for tokenType := TokenLeftParen; tokenType <= TokenInterpolation; tokenType++ {
+		name := tokenType.String()
+		if _, e := strconv.Atoi(name); e == nil {
+			t.Errorf("expected token type %d to have a name, got %q", tokenType, name)
+		}
+	}
+	if token := (Token{Type: TokenAnd, Lexeme: "and"}); token.String() != "AND and <nil>" {
+		t.Errorf("unexpected token string %q", token.String())
+	}
+}
+
+// The values of token types must never change, see the definition of TokenType.
+func TestTokenTypeValuesArePinned(t *testing.T) {
+	tests := map[TokenType]int{
+		TokenLeftParen:  0,
+		TokenColon:      14,
+		TokenBang:       15,
+		TokenSlashEqual: 26,
+		TokenIdentifier: 27,
+		TokenNumber:     29,
+		TokenAnd:        30,
+		TokenWhile:      47,
+		TokenEof:        48,
+	}
+	for tokenType, expected := range tests {
+		if int(tokenType) != expected {
+			t.Errorf("expected %s to have value %d, got %d", tokenType, expected, int(tokenType))
+		}
+	}
+}
+
+// parseExpression parses the source as a single expression and fails the test on errors.
+func parseExpression(t *testing.T, source string) Expr {
+	reporter := CollectingErrorReporter{}
+	scanner := NewScanner([]byte(source), &reporter)
+	parser := NewParser(scanner.ScanTokens(), &reporter)
+	expr, _ := parser.ParseExpression()
+	if errors := reporter.Errors(); len(errors) > 0 {
+		t.Fatalf("unexpected errors parsing %s: %v", source, errors)
+	}
+	return expr
+}
+
+// The expected trees were printed by the recursive descent parser that had a function
+// per precedence level, before binary operators were parsed by precedence climbing.
+func TestBinaryOperatorPrecedence(t *testing.T) {
+	tests := map[string]string{
+		"1 + 2 * 3 - 4 / 5":      "(- (+ 1 (* 2 3)) (/ 4 5))",
+		"1 - 2 - 3":              "(- (- 1 2) 3)",
+		"a or b and c":           "(or a (and b c))",
+		"a and b or c and d":     "(or (and a b) (and c d))",
+		"!a == b":                "(== (! a) b)",
+		"1 < 2 == 3 >= 4":        "(== (< 1 2) (>= 3 4))",
+		"1 | 2 & 3 ^ 4":          "(^ (& (| 1 2) 3) 4)",
+		"1 & 2 == 2":             "(& 1 (== 2 2))",
+		"a == b or c != d":       "(or (== a b) (!= c d))",
+		"-2 ** 2":                "(- (** 2 2))",
+		"2 ** 3 ** 2":            "(** 2 (** 3 2))",
+		"2 ** -1":                "(** 2 (- 1))",
+		"a * -b ** c":            "(* a (- (** b c)))",
+		"2 ** 3 * 4":             "(* (** 2 3) 4)",
+		"~a & b":                 "(& (~ a) b)",
+		"7 div 2 * 3 + 1":        "(+ (* (div 7 2) 3) 1)",
+		"a ? b : c ? d : e":      "(?: a b (?: c d e))",
+		"a or b ? c + 1 : d * 2": "(?: (or a b) (+ c 1) (* d 2))",
+		"x = y = 1 + 2":          "(= x (= y (+ 1 2)))",
+		"x += 2 * 3":             "(= x (+ x (* 2 3)))",
+		"a, b = 1, c":            "(, (, a (= b 1)) c)",
+		"f(1, 2 + 3)[0].g ** 2":  "(** (. ([] (call f 1 (+ 2 3)) 0) g) 2)",
+		"!!a or -b < c":          "(or (! (! a)) (< (- b) c))",
+		"(1 + 2) * 3":            "(* (group (+ 1 2)) 3)",
+		"1 + 2 < 3 | 4 and 5":    "(and (| (< (+ 1 2) 3) 4) 5)",
+		"a.b = c or d":           "(.= a b (or c d))",
+		"a ?? b or c ?? d":       "(?? (?? a (or b c)) d)",
+		"a ?? b ? c : d":         "(?: (?? a b) c d)",
+	}
+	for source, expected := range tests {
+		if printed := (AstPrinter{}).PrintExpr(parseExpression(t, source)); printed != expected {
+			t.Errorf("expected %s to be parsed as %s, got %s", source, expected, printed)
+		}
+	}
+}
+
+func TestTernaryIsRightAssociative(t *testing.T) {
+	tests := map[string]string{
+		"a ? b : c ? d : e":            "(?: a b (?: c d e))",
+		"a ? b ? c : d : e":            "(?: a (?: b c d) e)",
+		"a ? b : c, d":                 "(, (?: a b c) d)",
+		"x = a ? b : c":                "(= x (?: a b c))",
+		"a or b ? c : d and e ? f : g": "(?: (or a b) c (?: (and d e) f g))",
+	}
+	for source, expected := range tests {
+		if printed := (AstPrinter{}).PrintExpr(parseExpression(t, source)); printed != expected {
+			t.Errorf("expected %s to be parsed as %s, got %s", source, expected, printed)
+		}
+	}
+}
+
+func TestExponentIsRightAssociative(t *testing.T) {
+	tests := map[string]string{
+		"2 ** 3 ** 2": "(** 2 (** 3 2))",
+		"-a ** b":     "(- (** a b))",
+		"a ** -b":     "(** a (- b))",
+		"a * b ** c":  "(* a (** b c))",
+	}
+	for source, expected := range tests {
+		if printed := (AstPrinter{}).PrintExpr(parseExpression(t, source)); printed != expected {
+			t.Errorf("expected %s to be parsed as %s, got %s", source, expected, printed)
+		}
+	}
+}
+
+func TestTernaryMissingColon(t *testing.T) {
+	reporter := CollectingErrorReporter{}
+	frontend := NewFrontend([]byte("print a ? b;"), &reporter)
+	frontend.Parse()
+
+	errors := reporter.Errors()
+	if len(errors) != 1 || errors[0].Message != "Expect ':' after the true branch of the ternary operator." {
+		t.Errorf("expected a missing colon error, got %v", errors)
+	}
+}
+
+func TestChainedComparison(t *testing.T) {
+	tests := map[string]int{
+		// The column of the second comparison operator.
+		"print 1 < 2 < 3;":      13,
+		"print 1 <= 2 > 3 < 4;": 14,
+		"print a >= b <= c;":    14,
+	}
+	for source, column := range tests {
+		reporter := CollectingErrorReporter{}
+		frontend := NewFrontend([]byte(source), &reporter)
+		frontend.Parse()
+
+		errors := reporter.Errors()
+		if len(errors) != 1 || errors[0].Message != "Chained comparison is not supported; use 'and'." || errors[0].Column != column {
+			t.Errorf("expected a single chained comparison error at column %d for %s, got %v", column, source, errors)
+		}
+	}
+
+	// Comparisons of different precedence levels aren't chained.
+	parseExpression(t, "1 < 2 == 3 > 4")
+	parseExpression(t, "1 < 2 and 2 < 3")
+}
+
+func TestTrailingCommas(t *testing.T) {
+	tests := map[string]string{
+		"[1, 2, 3,]":        "(list 1 2 3)",
+		"[1,]":              "(list 1)",
+		"f(a, b,)":          "(call f a b)",
+		`{"a": 1, "b": 2,}`: `(map "a":1 "b":2)`,
+		"[\n  1,\n  2,\n]":  "(list 1 2)",
+	}
+	for source, expected := range tests {
+		if printed := (AstPrinter{}).PrintExpr(parseExpression(t, source)); printed != expected {
+			t.Errorf("expected %s to be parsed as %s, got %s", source, expected, printed)
+		}
+	}
+
+	for _, source := range []string{"[1,,2];", "[,1];", "[,];", "f(,);", "f(a,,);", `({"a": 1,,});`} {
+		reporter := CollectingErrorReporter{}
+		frontend := NewFrontend([]byte(source), &reporter)
+		frontend.Parse()
+		if errors := reporter.Errors(); len(errors) == 0 || errors[0].Message != "Expect expression." {
+			t.Errorf("expected an empty element in %s to be an error, got %v", source, errors)
+		}
+	}
+}
+
+func TestBinaryOperatorMissingLeftOperand(t *testing.T) {
+	for _, source := range []string{"+ 1;", "* 2;", ">= 3;", "== 4 + 5;", "print 1 + (/ 2);"} {
+		reporter := CollectingErrorReporter{}
+		frontend := NewFrontend([]byte(source), &reporter)
+		frontend.Parse()
+
+		errors := reporter.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected a single error for %s, got %v", source, errors)
+		} else if errors[0].Message != "Binary operator requires a left-hand operand." {
+			t.Errorf("unexpected error for %s: %v", source, errors[0])
+		}
+	}
+}
+
+func TestExpressionNestingTooDeep(t *testing.T) {
+	for _, source := range []string{
+		strings.Repeat("(", 10000) + "1" + strings.Repeat(")", 10000) + ";",
+		strings.Repeat("(", 10000),
+		strings.Repeat("!", 10000) + "true;",
+	} {
+		reporter := CollectingErrorReporter{}
+		frontend := NewFrontend([]byte(source), &reporter)
+		frontend.Parse()
+
+		errors := reporter.Errors()
+		if len(errors) != 1 || errors[0].Message != "Expression nesting too deep." {
+			t.Errorf("unexpected errors %v", errors)
+		}
+	}
+
+	// Nesting below the limit is fine.
+	parseExpression(t, strings.Repeat("(", 100)+"1"+strings.Repeat(")", 100))
+}
+
+func BenchmarkScanTokens(b *testing.B) {
+	source := benchmarkSource()
+	b.SetBytes(int64(len(source)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scanner := NewScanner(source, &CollectingErrorReporter{})
+		scanner.ScanTokens()
+	}
+}
+
+// benchmarkSource is a large program used to benchmark the scanner.
+func benchmarkSource() []byte {
+	snippet := `// Compute some values.
+fun fib(n) {
+	if (n < 2) return n;
+	return fib(n - 1) + fib(n - 2);
+}
+var greeting = "héllo, wörld é";
+var total = 0x1F + 0b101 + 12.5;
+/* a block /* nested */ comment */
+print greeting + " " + fib(10) >= total;
+`
+	return []byte(strings.Repeat(snippet, 1000))
+}
+
+func BenchmarkTokenString(b *testing.B) {
+	scanner := NewScanner(benchmarkSource(), &CollectingErrorReporter{})
+	tokens := scanner.ScanTokens()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, token := range tokens {
+			_ = token.String()
+		}
+	}
+}
+
+func TestInterpolationTokens(t *testing.T) {
+	reporter := CollectingErrorReporter{}
+	scanner := NewScanner([]byte(`"a${b}c${ {} }"`), &reporter)
+	tokens := scanner.ScanTokens()
+	expected := []TokenType{TokenInterpolation, TokenIdentifier, TokenInterpolation, TokenLeftBrace, TokenRightBrace, TokenString, TokenEof}
+	if errors := reporter.Errors(); len(errors) > 0 {
+		t.Fatalf("unexpected errors %v", errors)
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %v", len(expected), tokens)
+	}
+	for i, token := range tokens {
+		if token.Type != expected[i] {
+			t.Errorf("expected token %d to be %v, got %v", i, expected[i], token)
+		}
+	}
+
+	if printed := (AstPrinter{}).PrintExpr(parseExpression(t, `"a${b}c${1 + 2}"`)); printed != `(str "a" b "c" (+ 1 2))` {
+		t.Errorf("unexpected interpolation %s", printed)
+	}
+
+	reporter = CollectingErrorReporter{}
+	frontend := NewFrontend([]byte(`print "a${b c}";`), &reporter)
+	frontend.Parse()
+	if errors := reporter.Errors(); len(errors) == 0 || errors[0].Message != "Expect '}' after interpolated expression." {
+		t.Errorf("expected a missing brace error, got %v", errors)
+	}
+
+	for _, source := range []string{"print \"a ${1 + 2\";", "print \"a ${1 + 2\";\nprint \"b\";"} {
+		reporter = CollectingErrorReporter{}
+		frontend = NewFrontend([]byte(source), &reporter)
+		statements := frontend.Parse()
+		if errors := reporter.Errors(); len(errors) != 1 || errors[0].Error() != "[line 1, col 10] Error: Expect '}' after interpolated expression." {
+			t.Errorf("expected only a missing brace error at the ${ in %q, got %v", source, errors)
+		}
+		if len(statements) != strings.Count(source, "print") {
+			t.Errorf("expected parsing to continue after the missing brace in %q, got %v", source, statements)
+		}
+	}
+}
@@ -0,0 +1,492 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MarshalAST serializes the expression to JSON, e.g. for external tools. Every node is an
+// object with a "node" field naming the type of node, and a field for each child. Tokens
+// are objects with their type, lexeme and position. Floating point numbers are written
+// with a decimal point, e.g. 2.0, to tell them apart from integers.
+func MarshalAST(expr Expr) ([]byte, error) {
+	e, tree := expr.Visit(astMarshaler{})
+	if e != nil {
+		return nil, e
+	}
+	return json.Marshal(tree)
+}
+
+// jsonNode is the JSON representation of a node. Maps are marshalled with sorted keys, so
+// the output is stable.
+type jsonNode map[string]interface{}
+
+type jsonToken struct {
+	Type   string `json:"type"`
+	Lexeme string `json:"lexeme"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+func toJSONToken(token Token) jsonToken {
+	return jsonToken{
+		Type:   token.Type.String(),
+		Lexeme: token.Lexeme,
+		Line:   token.Line,
+		Column: token.Column,
+	}
+}
+
+// astMarshaler converts the nodes to their JSON representation.
+type astMarshaler struct{}
+
+func (marshaler astMarshaler) marshal(expr Expr) (interface{}, error) {
+	e, node := expr.Visit(marshaler)
+	return node, e
+}
+
+// marshalAll converts the expressions, stopping at the first error.
+func (marshaler astMarshaler) marshalAll(exprs []Expr) ([]interface{}, error) {
+	nodes := make([]interface{}, len(exprs))
+	for i, expr := range exprs {
+		node, e := marshaler.marshal(expr)
+		if e != nil {
+			return nil, e
+		}
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+// node builds a node from the children, which are alternately a field name and an
+// expression.
+func (marshaler astMarshaler) node(name string, fields jsonNode, children ...interface{}) (error, interface{}) {
+	node := jsonNode{"node": name}
+	for field, value := range fields {
+		node[field] = value
+	}
+	for i := 0; i < len(children); i += 2 {
+		child, e := marshaler.marshal(children[i+1].(Expr))
+		if e != nil {
+			return e, nil
+		}
+		node[children[i].(string)] = child
+	}
+	return nil, node
+}
+
+func (marshaler astMarshaler) VisitBinary(binary Binary) (error, interface{}) {
+	return marshaler.node("Binary", jsonNode{"operator": toJSONToken(binary.Operator)},
+		"left", binary.Left, "right", binary.Right)
+}
+
+func (marshaler astMarshaler) VisitGrouping(grouping Grouping) (error, interface{}) {
+	return marshaler.node("Grouping", nil, "expression", grouping.Expression)
+}
+
+func (marshaler astMarshaler) VisitLiteral(literal Literal) (error, interface{}) {
+	var value interface{}
+	switch v := literal.Value.(type) {
+	case nil:
+	case Number:
+		value = floatJSON(v.V)
+	case Integer:
+		value = v.V
+	case String:
+		value = v.V
+	case Boolean:
+		value = v.V
+	default:
+		return fmt.Errorf("cannot marshal literal %v", v), nil
+	}
+	return nil, jsonNode{"node": "Literal", "value": value}
+}
+
+func (marshaler astMarshaler) VisitUnary(unary Unary) (error, interface{}) {
+	return marshaler.node("Unary", jsonNode{"operator": toJSONToken(unary.Operator)}, "right", unary.Right)
+}
+
+func (marshaler astMarshaler) VisitTernary(ternary Ternary) (error, interface{}) {
+	return marshaler.node("Ternary", jsonNode{"question": toJSONToken(ternary.Question)},
+		"cond", ternary.Cond, "trueBranch", ternary.TrueBranch, "falseBranch", ternary.FalseBranch)
+}
+
+func (marshaler astMarshaler) VisitVariable(variable Variable) (error, interface{}) {
+	return marshaler.node("Variable", jsonNode{"name": toJSONToken(variable.Name)})
+}
+
+func (marshaler astMarshaler) VisitAssign(assign Assign) (error, interface{}) {
+	return marshaler.node("Assign", jsonNode{"name": toJSONToken(assign.Name)}, "value", assign.Value)
+}
+
+func (marshaler astMarshaler) VisitLogical(logical Logical) (error, interface{}) {
+	return marshaler.node("Logical", jsonNode{"operator": toJSONToken(logical.Operator)},
+		"left", logical.Left, "right", logical.Right)
+}
+
+func (marshaler astMarshaler) VisitCall(call Call) (error, interface{}) {
+	arguments, e := marshaler.marshalAll(call.Arguments)
+	if e != nil {
+		return e, nil
+	}
+	return marshaler.node("Call", jsonNode{"paren": toJSONToken(call.Paren), "arguments": arguments},
+		"callee", call.Callee)
+}
+
+func (marshaler astMarshaler) VisitList(list List) (error, interface{}) {
+	elements, e := marshaler.marshalAll(list.Elements)
+	if e != nil {
+		return e, nil
+	}
+	return marshaler.node("List", jsonNode{"bracket": toJSONToken(list.Bracket), "elements": elements})
+}
+
+func (marshaler astMarshaler) VisitInterpolation(interpolation Interpolation) (error, interface{}) {
+	parts, e := marshaler.marshalAll(interpolation.Parts)
+	if e != nil {
+		return e, nil
+	}
+	return marshaler.node("Interpolation", jsonNode{"start": toJSONToken(interpolation.Start), "parts": parts})
+}
+
+func (marshaler astMarshaler) VisitIndex(index Index) (error, interface{}) {
+	return marshaler.node("Index", jsonNode{"bracket": toJSONToken(index.Bracket)},
+		"object", index.Object, "index", index.Index)
+}
+
+func (marshaler astMarshaler) VisitSetIndex(index SetIndex) (error, interface{}) {
+	return marshaler.node("SetIndex", jsonNode{"bracket": toJSONToken(index.Bracket)},
+		"object", index.Object, "index", index.Index, "value", index.Value)
+}
+
+func (marshaler astMarshaler) VisitMap(m Map) (error, interface{}) {
+	keys, e := marshaler.marshalAll(m.Keys)
+	if e != nil {
+		return e, nil
+	}
+	values, e := marshaler.marshalAll(m.Values)
+	if e != nil {
+		return e, nil
+	}
+	return marshaler.node("Map", jsonNode{"brace": toJSONToken(m.Brace), "keys": keys, "values": values})
+}
+
+func (marshaler astMarshaler) VisitGet(get Get) (error, interface{}) {
+	return marshaler.node("Get", jsonNode{"name": toJSONToken(get.Name)}, "object", get.Object)
+}
+
+func (marshaler astMarshaler) VisitSet(set Set) (error, interface{}) {
+	return marshaler.node("Set", jsonNode{"name": toJSONToken(set.Name)}, "object", set.Object, "value", set.Value)
+}
+
+func (marshaler astMarshaler) VisitThis(this This) (error, interface{}) {
+	return marshaler.node("This", jsonNode{"keyword": toJSONToken(this.Keyword)})
+}
+
+func (marshaler astMarshaler) VisitSuper(super Super) (error, interface{}) {
+	return marshaler.node("Super", jsonNode{"keyword": toJSONToken(super.Keyword), "method": toJSONToken(super.Method)})
+}
+
+// Lambdas contain statements, which can't be serialized.
+func (marshaler astMarshaler) VisitLambda(lambda Lambda) (error, interface{}) {
+	return fmt.Errorf("cannot marshal the function at line %d", lambda.Declaration.Name.Line), nil
+}
+
+// UnmarshalAST reconstructs an expression from the JSON produced by MarshalAST.
+func UnmarshalAST(data []byte) (Expr, error) {
+	// Keep numbers as they are written, to tell integers and floating point numbers apart.
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var tree interface{}
+	if e := decoder.Decode(&tree); e != nil {
+		return nil, e
+	}
+	if _, e := decoder.Token(); e != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the node")
+	}
+	return unmarshalExpr(tree)
+}
+
+// floatJSON writes a floating point number with a decimal point, even if it is whole.
+func floatJSON(n float64) json.Number {
+	s := strconv.FormatFloat(n, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return json.Number(s)
+}
+
+func unmarshalExpr(value interface{}) (Expr, error) {
+	object, isObject := value.(map[string]interface{})
+	if !isObject {
+		return nil, fmt.Errorf("expected a node, got %v", value)
+	}
+
+	node, _ := object["node"].(string)
+	switch node {
+	case "Binary", "Logical":
+		left, e := exprField(object, "left")
+		if e != nil {
+			return nil, e
+		}
+		operator, e := tokenField(object, "operator")
+		if e != nil {
+			return nil, e
+		}
+		right, e := exprField(object, "right")
+		if e != nil {
+			return nil, e
+		}
+		if node == "Logical" {
+			return Logical{Left: left, Operator: operator, Right: right}, nil
+		}
+		return Binary{Left: left, Operator: operator, Right: right}, nil
+	case "Grouping":
+		expression, e := exprField(object, "expression")
+		if e != nil {
+			return nil, e
+		}
+		return Grouping{Expression: expression}, nil
+	case "Literal":
+		switch v := object["value"].(type) {
+		case nil:
+			return Literal{Value: nil}, nil
+		case json.Number:
+			if !strings.ContainsAny(v.String(), ".eE") {
+				if i, e := v.Int64(); e == nil {
+					return Literal{Value: Integer{V: i}}, nil
+				}
+			}
+			f, e := v.Float64()
+			if e != nil {
+				return nil, fmt.Errorf("malformed literal value %v", v)
+			}
+			return Literal{Value: Number{V: f}}, nil
+		case string:
+			return Literal{Value: String{V: v}}, nil
+		case bool:
+			return Literal{Value: Boolean{V: v}}, nil
+		default:
+			return nil, fmt.Errorf("malformed literal value %v", v)
+		}
+	case "Unary":
+		operator, e := tokenField(object, "operator")
+		if e != nil {
+			return nil, e
+		}
+		right, e := exprField(object, "right")
+		if e != nil {
+			return nil, e
+		}
+		return Unary{Operator: operator, Right: right}, nil
+	case "Ternary":
+		exprs, e := exprFields(object, "cond", "trueBranch", "falseBranch")
+		if e != nil {
+			return nil, e
+		}
+		question, e := tokenField(object, "question")
+		if e != nil {
+			return nil, e
+		}
+		return Ternary{Cond: exprs[0], Question: question, TrueBranch: exprs[1], FalseBranch: exprs[2]}, nil
+	case "Variable":
+		name, e := tokenField(object, "name")
+		if e != nil {
+			return nil, e
+		}
+		return Variable{Name: name, Resolution: &Resolution{}}, nil
+	case "Assign":
+		name, e := tokenField(object, "name")
+		if e != nil {
+			return nil, e
+		}
+		value, e := exprField(object, "value")
+		if e != nil {
+			return nil, e
+		}
+		return Assign{Name: name, Value: value, Resolution: &Resolution{}}, nil
+	case "Call":
+		callee, e := exprField(object, "callee")
+		if e != nil {
+			return nil, e
+		}
+		paren, e := tokenField(object, "paren")
+		if e != nil {
+			return nil, e
+		}
+		arguments, e := exprListField(object, "arguments")
+		if e != nil {
+			return nil, e
+		}
+		return Call{Callee: callee, Paren: paren, Arguments: arguments}, nil
+	case "List":
+		bracket, e := tokenField(object, "bracket")
+		if e != nil {
+			return nil, e
+		}
+		elements, e := exprListField(object, "elements")
+		if e != nil {
+			return nil, e
+		}
+		return List{Bracket: bracket, Elements: elements}, nil
+	case "Index":
+		bracket, e := tokenField(object, "bracket")
+		if e != nil {
+			return nil, e
+		}
+		exprs, e := exprFields(object, "object", "index")
+		if e != nil {
+			return nil, e
+		}
+		return Index{Object: exprs[0], Bracket: bracket, Index: exprs[1]}, nil
+	case "SetIndex":
+		bracket, e := tokenField(object, "bracket")
+		if e != nil {
+			return nil, e
+		}
+		exprs, e := exprFields(object, "object", "index", "value")
+		if e != nil {
+			return nil, e
+		}
+		return SetIndex{Object: exprs[0], Bracket: bracket, Index: exprs[1], Value: exprs[2]}, nil
+	case "Map":
+		brace, e := tokenField(object, "brace")
+		if e != nil {
+			return nil, e
+		}
+		keys, e := exprListField(object, "keys")
+		if e != nil {
+			return nil, e
+		}
+		values, e := exprListField(object, "values")
+		if e != nil {
+			return nil, e
+		}
+		if len(keys) != len(values) {
+			return nil, fmt.Errorf("map node has %d keys but %d values", len(keys), len(values))
+		}
+		return Map{Brace: brace, Keys: keys, Values: values}, nil
+	case "Get", "Set":
+		name, e := tokenField(object, "name")
+		if e != nil {
+			return nil, e
+		}
+		target, e := exprField(object, "object")
+		if e != nil {
+			return nil, e
+		}
+		if node == "Get" {
+			return Get{Object: target, Name: name}, nil
+		}
+		value, e := exprField(object, "value")
+		if e != nil {
+			return nil, e
+		}
+		return Set{Object: target, Name: name, Value: value}, nil
+	case "This":
+		keyword, e := tokenField(object, "keyword")
+		if e != nil {
+			return nil, e
+		}
+		return This{Keyword: keyword, Resolution: &Resolution{}}, nil
+	case "Super":
+		keyword, e := tokenField(object, "keyword")
+		if e != nil {
+			return nil, e
+		}
+		method, e := tokenField(object, "method")
+		if e != nil {
+			return nil, e
+		}
+		return Super{Keyword: keyword, Method: method, Resolution: &Resolution{}}, nil
+	case "Interpolation":
+		start, e := tokenField(object, "start")
+		if e != nil {
+			return nil, e
+		}
+		parts, e := exprListField(object, "parts")
+		if e != nil {
+			return nil, e
+		}
+		return Interpolation{Start: start, Parts: parts}, nil
+	default:
+		return nil, fmt.Errorf("unknown node %q", node)
+	}
+}
+
+func exprField(object map[string]interface{}, field string) (Expr, error) {
+	value, found := object[field]
+	if !found {
+		return nil, fmt.Errorf("%v node is missing the field %q", object["node"], field)
+	}
+	return unmarshalExpr(value)
+}
+
+// exprFields unmarshals the fields in order, stopping at the first error.
+func exprFields(object map[string]interface{}, fields ...string) ([]Expr, error) {
+	exprs := make([]Expr, len(fields))
+	for i, field := range fields {
+		expr, e := exprField(object, field)
+		if e != nil {
+			return nil, e
+		}
+		exprs[i] = expr
+	}
+	return exprs, nil
+}
+
+func exprListField(object map[string]interface{}, field string) ([]Expr, error) {
+	values, isList := object[field].([]interface{})
+	if !isList {
+		return nil, fmt.Errorf("%v node is missing the list %q", object["node"], field)
+	}
+	exprs := make([]Expr, len(values))
+	for i, value := range values {
+		expr, e := unmarshalExpr(value)
+		if e != nil {
+			return nil, e
+		}
+		exprs[i] = expr
+	}
+	return exprs, nil
+}
+
+func tokenField(object map[string]interface{}, field string) (Token, error) {
+	value, found := object[field]
+	if !found {
+		return Token{}, fmt.Errorf("%v node is missing the token %q", object["node"], field)
+	}
+	// Decode the token again, now that we know what to expect.
+	data, e := json.Marshal(value)
+	if e != nil {
+		return Token{}, e
+	}
+	var token jsonToken
+	if e := json.Unmarshal(data, &token); e != nil {
+		return Token{}, fmt.Errorf("malformed token %q: %v", field, e)
+	}
+
+	tokenType, known := tokenTypeByName(token.Type)
+	if !known {
+		return Token{}, fmt.Errorf("unknown token type %q", token.Type)
+	}
+	return Token{
+		Type:   tokenType,
+		Lexeme: token.Lexeme,
+		Line:   token.Line,
+		Column: token.Column,
+	}, nil
+}
+
+func tokenTypeByName(name string) (TokenType, bool) {
+	for tokenType, tokenTypeName := range tokenTypeNames {
+		if tokenTypeName != "" && tokenTypeName == name {
+			return TokenType(tokenType), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMarshalAST(t *testing.T) {
+	tests := map[string]string{
+		"1 + 2.5": `{"left":{"node":"Literal","value":1},"node":"Binary",` +
+			`"operator":{"type":"PLUS","lexeme":"+","line":1,"column":3},"right":{"node":"Literal","value":2.5}}`,
+		"-x": `{"node":"Unary","operator":{"type":"MINUS","lexeme":"-","line":1,"column":1},` +
+			`"right":{"name":{"type":"IDENTIFIER","lexeme":"x","line":1,"column":2},"node":"Variable"}}`,
+		"2.0 * 3": `{"left":{"node":"Literal","value":2.0},"node":"Binary",` +
+			`"operator":{"type":"STAR","lexeme":"*","line":1,"column":5},"right":{"node":"Literal","value":3}}`,
+		"(nil)": `{"expression":{"node":"Literal","value":null},"node":"Grouping"}`,
+		`true ? "a" : false`: `{"cond":{"node":"Literal","value":true},` +
+			`"falseBranch":{"node":"Literal","value":false},"node":"Ternary",` +
+			`"question":{"type":"QUESTION","lexeme":"?","line":1,"column":6},"trueBranch":{"node":"Literal","value":"a"}}`,
+	}
+	for source, expected := range tests {
+		json, e := MarshalAST(parseExpression(t, source))
+		if e != nil {
+			t.Errorf("unexpected error marshalling %s: %v", source, e)
+		} else if string(json) != expected {
+			t.Errorf("expected %s to be marshalled as\n%s\ngot\n%s", source, expected, json)
+		}
+	}
+
+	if _, e := MarshalAST(parseExpression(t, "fun () {}")); e == nil {
+		t.Error("expected an error marshalling a function")
+	}
+}
+
+func TestUnmarshalAST(t *testing.T) {
+	for _, source := range []string{
+		"1 + 2 * 3",
+		"2.0 * 3",
+		`-(4 - 1) >= 2 ? "yes" : nil`,
+		`!false and true or nil`,
+		`[1, 2, 3][1]`,
+		`{"a": 1, "b": 2}["b"]`,
+		`len("abc")`,
+	} {
+		json, e := MarshalAST(parseExpression(t, source))
+		if e != nil {
+			t.Fatalf("unexpected error marshalling %s: %v", source, e)
+		}
+		expr, e := UnmarshalAST(json)
+		if e != nil {
+			t.Fatalf("unexpected error unmarshalling %s: %v", json, e)
+		}
+
+		interpreter := NewInterpreter(&CollectingErrorReporter{}, nil)
+		e, value := interpreter.visit(expr)
+		if e != nil {
+			t.Errorf("unexpected error evaluating %s: %v", source, e)
+		}
+		// The type tells integers and floating point numbers apart.
+		if expected, _ := Eval([]byte(source)); stringify(value) != stringify(expected) || fmt.Sprintf("%T", value) != fmt.Sprintf("%T", expected) {
+			t.Errorf("expected %s to evaluate to %#v, got %#v", source, expected, value)
+		}
+	}
+}
+
+func TestUnmarshalASTErrors(t *testing.T) {
+	tests := map[string]string{
+		`{"node":"Statement"}`:                                    `unknown node "Statement"`,
+		`{"node":"Literal","value":[1]}`:                          "malformed literal value [1]",
+		`{"node":"Grouping"}`:                                     `Grouping node is missing the field "expression"`,
+		`{"node":"Variable","name":{"type":"NAME","lexeme":"x"}}`: `unknown token type "NAME"`,
+		`[]`: "expected a node, got []",
+	}
+	for json, expected := range tests {
+		if _, e := UnmarshalAST([]byte(json)); e == nil || e.Error() != expected {
+			t.Errorf("expected error %q unmarshalling %s, got %v", expected, json, e)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// defineNatives installs the native functions in the global environment.
+func defineNatives(globals *Environment) {
+	globals.Define("clock", clock{})
+	globals.Define("len", length{})
+	globals.Define("input", input{})
+	globals.Define("write", write{})
+	globals.Define("upper", stringFunction("upper", strings.ToUpper))
+	globals.Define("lower", stringFunction("lower", strings.ToLower))
+	globals.Define("trim", stringFunction("trim", strings.TrimSpace))
+	globals.Define("number", &native{arity: 1, fn: parseNumber})
+	globals.Define("str", str{})
+	globals.Define("sqrt", &native{arity: 1, fn: squareRoot})
+	globals.Define("floor", numberFunction("floor", math.Floor))
+	globals.Define("ceil", numberFunction("ceil", math.Ceil))
+	globals.Define("abs", numberFunction("abs", math.Abs))
+	globals.Define("min", binaryNumberFunction("min", math.Min))
+	globals.Define("max", binaryNumberFunction("max", math.Max))
+}
+
+// isNative reports whether the value is a function implemented in Golang.
+func isNative(value interface{}) bool {
+	switch value.(type) {
+	case *native, clock, length, input, write, str:
+		return true
+	}
+	return false
+}
+
+// squareRoot returns the square root of a number. Lox has no NaN literal and NaN isn't
+// equal to itself, so a negative number is a runtime error rather than returning NaN.
+func squareRoot(args []interface{}) (interface{}, error) {
+	n, isNumber := toFloat(args[0])
+	if !isNumber {
+		return nil, errors.New("sqrt expects a number.")
+	}
+	if n < 0 {
+		return nil, errors.New("sqrt expects a non-negative number.")
+	}
+	return math.Sqrt(n), nil
+}
+
+// parseNumber converts a string, such as "3.14", to a number. Like number literals, a
+// string without a decimal point is converted to an integer.
+func parseNumber(args []interface{}) (interface{}, error) {
+	s, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("number expects a string.")
+	}
+	if i, e := strconv.ParseInt(s, 10, 64); e == nil {
+		return i, nil
+	}
+	n, e := strconv.ParseFloat(s, 64)
+	if e != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+		return nil, fmt.Errorf("Can't parse '%s' as a number.", s)
+	}
+	return n, nil
+}
+
+// clock returns the number of seconds since the Unix epoch.
+type clock struct{}
+
+func (c clock) Arity() int {
+	return 0
+}
+
+func (c clock) Call(interpreter *Interpreter, arguments []interface{}) (error, interface{}) {
+	return nil, float64(time.Now().UnixNano()) / float64(time.Second)
+}
+
+func (c clock) String() string {
+	return "<native fn>"
+}
+
+// input prints a prompt and reads a line of input. The line is returned without its line
+// ending, or nil is returned at the end of the input.
+type input struct{}
+
+func (i input) Arity() int {
+	return 1
+}
+
+func (i input) Call(interpreter *Interpreter, arguments []interface{}) (error, interface{}) {
+	prompt, isString := arguments[0].(string)
+	if !isString {
+		return errors.New("input expects a string prompt."), nil
+	}
+	if _, e := fmt.Fprint(interpreter.out, prompt); e != nil {
+		return e, nil
+	}
+	line, e := interpreter.in.ReadString('\n')
+	if e == io.EOF && line == "" {
+		return nil, nil
+	} else if e != nil && e != io.EOF {
+		return e, nil
+	}
+	return nil, strings.TrimRight(line, "\r\n")
+}
+
+func (i input) String() string {
+	return "<native fn>"
+}
+
+// write prints a value like the print statement but without a line ending, so that a line
+// can be printed piece by piece.
+type write struct{}
+
+func (w write) Arity() int {
+	return 1
+}
+
+func (w write) Call(interpreter *Interpreter, arguments []interface{}) (error, interface{}) {
+	_, e := fmt.Fprint(interpreter.out, interpreter.stringify(arguments[0]))
+	return e, nil
+}
+
+func (w write) String() string {
+	return "<native fn>"
+}
+
+// str converts a value to the string that the print statement prints for it.
+type str struct{}
+
+func (s str) Arity() int {
+	return 1
+}
+
+func (s str) Call(interpreter *Interpreter, arguments []interface{}) (error, interface{}) {
+	return nil, interpreter.stringify(arguments[0])
+}
+
+func (s str) String() string {
+	return "<native fn>"
+}
+
+// length returns the number of characters in a string or the number of elements in a list
+// or map.
+type length struct{}
+
+func (l length) Arity() int {
+	return 1
+}
+
+func (l length) Call(interpreter *Interpreter, arguments []interface{}) (error, interface{}) {
+	switch v := arguments[0].(type) {
+	case string:
+		return nil, int64(utf8.RuneCountInString(v))
+	case *LoxList:
+		return nil, int64(len(v.Elements))
+	case *LoxMap:
+		return nil, int64(v.Len())
+	default:
+		return errors.New("len expects a string, list or map."), nil
+	}
+}
+
+func (l length) String() string {
+	return "<native fn>"
+}
+
+// stringFunction wraps a Golang function that transforms a string as a native function.
+func stringFunction(name string, fn func(string) string) *native {
+	return &native{
+		arity: 1,
+		fn: func(args []interface{}) (interface{}, error) {
+			s, isString := args[0].(string)
+			if !isString {
+				return nil, errors.New(name + " expects a string.")
+			}
+			return fn(s), nil
+		},
+	}
+}
+
+// numberFunction wraps a Golang function of a number, such as math.Floor, as a native
+// function.
+func numberFunction(name string, fn func(float64) float64) *native {
+	return &native{
+		arity: 1,
+		fn: func(args []interface{}) (interface{}, error) {
+			n, isNumber := toFloat(args[0])
+			if !isNumber {
+				return nil, errors.New(name + " expects a number.")
+			}
+			return fn(n), nil
+		},
+	}
+}
+
+// binaryNumberFunction wraps a Golang function of two numbers as a native function.
+func binaryNumberFunction(name string, fn func(float64, float64) float64) *native {
+	return &native{
+		arity: 2,
+		fn: func(args []interface{}) (interface{}, error) {
+			a, aIsNumber := toFloat(args[0])
+			b, bIsNumber := toFloat(args[1])
+			if !aIsNumber || !bIsNumber {
+				return nil, errors.New(name + " expects two numbers.")
+			}
+			return fn(a, b), nil
+		},
+	}
+}
+
+// RegisterNative defines a global function, named name, that calls the Golang function fn.
+// The function is only called with exactly arity arguments.
+//
+// Lox values are passed to and returned from fn as regular Golang values: nil for nil,
+// bool for booleans, float64 for numbers and string for strings. Functions are passed as
+// a LoxCallable. Integers are passed as float64 too, but fn may return an int64 to return
+// an integer. An error returned by fn is raised as a runtime error at the call site.
+func (interpreter *Interpreter) RegisterNative(name string, arity int, fn func(args []interface{}) (interface{}, error)) {
+	interpreter.globals.Define(name, &native{
+		arity: arity,
+		fn: func(args []interface{}) (interface{}, error) {
+			for i, arg := range args {
+				if integer, isInteger := arg.(int64); isInteger {
+					args[i] = float64(integer)
+				}
+			}
+			return fn(args)
+		},
+	})
+}
+
+// native is a function implemented in Golang by the host program.
+type native struct {
+	arity int
+	fn    func(args []interface{}) (interface{}, error)
+}
+
+func (n *native) Arity() int {
+	return n.arity
+}
+
+func (n *native) Call(interpreter *Interpreter, arguments []interface{}) (error, interface{}) {
+	result, e := n.fn(arguments)
+	// Host functions may return a literal wrapper, e.g. a String.
+	return e, unwrap(result)
+}
+
+func (n *native) String() string {
+	return "<native fn>"
+}
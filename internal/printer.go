@@ -2,17 +2,39 @@ package internal
 
 import (
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 )
 
+// ShortestDecimals prints floating point numbers with as few decimals as needed to read
+// them back as the same number. See Interpreter.Decimals.
+const ShortestDecimals = -1
+
 // stringify is the default printer for Lox values.
 func stringify(loxValue interface{}) string {
+	return format(loxValue, ShortestDecimals)
+}
+
+// format prints the Lox value with floating point numbers, also those in lists and maps,
+// printed with the number of decimals.
+func format(loxValue interface{}, decimals int) string {
+	return formatNested(loxValue, decimals, nil)
+}
+
+// formatNested prints the Lox value like format. Printing holds the lists and maps that
+// are being printed and contain the value, so that a list or map that contains itself is
+// printed as [...] or {...} rather than forever.
+func formatNested(loxValue interface{}, decimals int, printing map[interface{}]bool) string {
 	if loxValue == nil {
 		return "nil"
 	}
 
 	switch v := loxValue.(type) {
 	case float64:
-		return fmt.Sprintf("%f", v)
+		return formatNumber(v, decimals)
+	case int64:
+		return strconv.FormatInt(v, 10)
 	case string:
 		return v
 	case bool:
@@ -21,8 +43,250 @@ func stringify(loxValue interface{}) string {
 		} else {
 			return "false"
 		}
+	case *LoxList:
+		return v.format(decimals, printing)
+	case *LoxMap:
+		return v.format(decimals, printing)
+	case fmt.Stringer:
+		return v.String()
 	default:
 		// Catch this case and add more type cases.
 		return fmt.Sprintf("_%v", v)
 	}
 }
+
+// formatNumber prints the number with the number of decimals. With ShortestDecimals, whole
+// numbers are printed without a decimal point and other numbers in the shortest form that
+// reads back as the same number, e.g. 0.30000000000000004 for 0.1 + 0.2.
+func formatNumber(n float64, decimals int) string {
+	if decimals != ShortestDecimals {
+		return strconv.FormatFloat(n, 'f', decimals, 64)
+	}
+	if n == math.Trunc(n) && !math.IsInf(n, 0) {
+		return strconv.FormatFloat(n, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
+
+// AstPrinter prints the AST in a parenthesized, Lisp-like form, e.g. `(* (- 5) (group 3))`.
+// This is useful to debug the precedence and associativity of the parser.
+type AstPrinter struct{}
+
+// Print prints each statement on a separate line.
+func (printer AstPrinter) Print(statements []Stmt) string {
+	return strings.Join(printer.stmts(statements), "\n")
+}
+
+// PrintExpr prints a single expression.
+func (printer AstPrinter) PrintExpr(expr Expr) string {
+	_, s := expr.Visit(printer)
+	return s.(string)
+}
+
+func (printer AstPrinter) stmt(stmt Stmt) string {
+	_, s := stmt.Visit(printer)
+	return s.(string)
+}
+
+func (printer AstPrinter) parenthesize(name string, parts ...string) (error, interface{}) {
+	return nil, "(" + strings.Join(append([]string{name}, parts...), " ") + ")"
+}
+
+func (printer AstPrinter) VisitBinary(binary Binary) (error, interface{}) {
+	return printer.parenthesize(binary.Operator.Lexeme, printer.PrintExpr(binary.Left), printer.PrintExpr(binary.Right))
+}
+
+func (printer AstPrinter) VisitGrouping(grouping Grouping) (error, interface{}) {
+	return printer.parenthesize("group", printer.PrintExpr(grouping.Expression))
+}
+
+func (printer AstPrinter) VisitLiteral(literal Literal) (error, interface{}) {
+	if literal.Value == nil {
+		return nil, "nil"
+	}
+	return nil, literal.Value.String()
+}
+
+func (printer AstPrinter) VisitUnary(unary Unary) (error, interface{}) {
+	return printer.parenthesize(unary.Operator.Lexeme, printer.PrintExpr(unary.Right))
+}
+
+func (printer AstPrinter) VisitTernary(ternary Ternary) (error, interface{}) {
+	return printer.parenthesize("?:", printer.PrintExpr(ternary.Cond), printer.PrintExpr(ternary.TrueBranch),
+		printer.PrintExpr(ternary.FalseBranch))
+}
+
+func (printer AstPrinter) VisitVariable(variable Variable) (error, interface{}) {
+	return nil, variable.Name.Lexeme
+}
+
+func (printer AstPrinter) VisitAssign(assign Assign) (error, interface{}) {
+	return printer.parenthesize("=", assign.Name.Lexeme, printer.PrintExpr(assign.Value))
+}
+
+func (printer AstPrinter) VisitLogical(logical Logical) (error, interface{}) {
+	return printer.parenthesize(logical.Operator.Lexeme, printer.PrintExpr(logical.Left), printer.PrintExpr(logical.Right))
+}
+
+func (printer AstPrinter) VisitCall(call Call) (error, interface{}) {
+	parts := []string{printer.PrintExpr(call.Callee)}
+	for _, argument := range call.Arguments {
+		parts = append(parts, printer.PrintExpr(argument))
+	}
+	return printer.parenthesize("call", parts...)
+}
+
+func (printer AstPrinter) VisitList(list List) (error, interface{}) {
+	elements := make([]string, len(list.Elements))
+	for i, element := range list.Elements {
+		elements[i] = printer.PrintExpr(element)
+	}
+	return printer.parenthesize("list", elements...)
+}
+
+func (printer AstPrinter) VisitMap(m Map) (error, interface{}) {
+	entries := make([]string, len(m.Keys))
+	for i := range m.Keys {
+		entries[i] = printer.PrintExpr(m.Keys[i]) + ":" + printer.PrintExpr(m.Values[i])
+	}
+	return printer.parenthesize("map", entries...)
+}
+
+func (printer AstPrinter) VisitIndex(index Index) (error, interface{}) {
+	return printer.parenthesize("[]", printer.PrintExpr(index.Object), printer.PrintExpr(index.Index))
+}
+
+func (printer AstPrinter) VisitSetIndex(index SetIndex) (error, interface{}) {
+	return printer.parenthesize("[]=", printer.PrintExpr(index.Object), printer.PrintExpr(index.Index),
+		printer.PrintExpr(index.Value))
+}
+
+func (printer AstPrinter) VisitGet(get Get) (error, interface{}) {
+	return printer.parenthesize(".", printer.PrintExpr(get.Object), get.Name.Lexeme)
+}
+
+func (printer AstPrinter) VisitSet(set Set) (error, interface{}) {
+	return printer.parenthesize(".=", printer.PrintExpr(set.Object), set.Name.Lexeme, printer.PrintExpr(set.Value))
+}
+
+func (printer AstPrinter) VisitThis(this This) (error, interface{}) {
+	return nil, "this"
+}
+
+func (printer AstPrinter) VisitSuper(super Super) (error, interface{}) {
+	return printer.parenthesize("super", super.Method.Lexeme)
+}
+
+func (printer AstPrinter) VisitLambda(lambda Lambda) (error, interface{}) {
+	return printer.parenthesize("fun", printer.function(lambda.Declaration)...)
+}
+
+func (printer AstPrinter) VisitInterpolation(interpolation Interpolation) (error, interface{}) {
+	parts := make([]string, len(interpolation.Parts))
+	for i, part := range interpolation.Parts {
+		parts[i] = printer.PrintExpr(part)
+	}
+	return printer.parenthesize("str", parts...)
+}
+
+func (printer AstPrinter) VisitExpression(stmt Expression) (error, interface{}) {
+	return printer.parenthesize(";", printer.PrintExpr(stmt.Expression))
+}
+
+func (printer AstPrinter) VisitPrint(stmt Print) (error, interface{}) {
+	values := make([]string, len(stmt.Expressions))
+	for i, expr := range stmt.Expressions {
+		values[i] = printer.PrintExpr(expr)
+	}
+	return printer.parenthesize("print", values...)
+}
+
+func (printer AstPrinter) VisitVar(stmt Var) (error, interface{}) {
+	if stmt.Initializer == nil {
+		return printer.parenthesize("var", stmt.Name.Lexeme)
+	}
+	return printer.parenthesize("var", stmt.Name.Lexeme, printer.PrintExpr(stmt.Initializer))
+}
+
+func (printer AstPrinter) VisitBlock(block Block) (error, interface{}) {
+	return printer.parenthesize("block", printer.stmts(block.Statements)...)
+}
+
+func (printer AstPrinter) VisitIf(stmt If) (error, interface{}) {
+	if stmt.ElseBranch == nil {
+		return printer.parenthesize("if", printer.PrintExpr(stmt.Condition), printer.stmt(stmt.ThenBranch))
+	}
+	return printer.parenthesize("if", printer.PrintExpr(stmt.Condition), printer.stmt(stmt.ThenBranch),
+		printer.stmt(stmt.ElseBranch))
+}
+
+func (printer AstPrinter) VisitWhile(stmt While) (error, interface{}) {
+	if stmt.Increment == nil {
+		return printer.parenthesize("while", printer.PrintExpr(stmt.Condition), printer.stmt(stmt.Body))
+	}
+	return printer.parenthesize("while", printer.PrintExpr(stmt.Condition), printer.stmt(stmt.Body),
+		printer.PrintExpr(stmt.Increment))
+}
+
+func (printer AstPrinter) VisitDoWhile(stmt DoWhile) (error, interface{}) {
+	return printer.parenthesize("do", printer.stmt(stmt.Body), printer.PrintExpr(stmt.Condition))
+}
+
+func (printer AstPrinter) VisitSwitch(stmt Switch) (error, interface{}) {
+	parts := []string{printer.PrintExpr(stmt.Subject)}
+	for i, value := range stmt.Cases {
+		parts = append(parts, "(case "+printer.PrintExpr(value)+" "+printer.stmt(stmt.Bodies[i])+")")
+	}
+	if stmt.Default != nil {
+		parts = append(parts, "(default "+printer.stmt(stmt.Default)+")")
+	}
+	return printer.parenthesize("switch", parts...)
+}
+
+func (printer AstPrinter) VisitBreak(stmt Break) (error, interface{}) {
+	return printer.parenthesize("break")
+}
+
+func (printer AstPrinter) VisitContinue(stmt Continue) (error, interface{}) {
+	return printer.parenthesize("continue")
+}
+
+func (printer AstPrinter) VisitFunction(stmt Function) (error, interface{}) {
+	return printer.parenthesize("fun", append([]string{stmt.Name.Lexeme}, printer.function(stmt)...)...)
+}
+
+// function returns the parts of a function after its name: the parameters and the body.
+func (printer AstPrinter) function(stmt Function) []string {
+	params := make([]string, len(stmt.Params))
+	for i, param := range stmt.Params {
+		params[i] = param.Lexeme
+	}
+	return append([]string{"(" + strings.Join(params, " ") + ")"}, printer.stmts(stmt.Body)...)
+}
+
+func (printer AstPrinter) VisitClass(stmt Class) (error, interface{}) {
+	parts := []string{stmt.Name.Lexeme}
+	if stmt.Superclass != nil {
+		parts = append(parts, "<", printer.PrintExpr(stmt.Superclass))
+	}
+	for _, method := range stmt.Methods {
+		_, part := printer.VisitFunction(method)
+		parts = append(parts, part.(string))
+	}
+	return printer.parenthesize("class", parts...)
+}
+
+func (printer AstPrinter) VisitReturn(stmt Return) (error, interface{}) {
+	if stmt.Value == nil {
+		return printer.parenthesize("return")
+	}
+	return printer.parenthesize("return", printer.PrintExpr(stmt.Value))
+}
+
+func (printer AstPrinter) stmts(statements []Stmt) []string {
+	parts := make([]string, len(statements))
+	for i, stmt := range statements {
+		parts[i] = printer.stmt(stmt)
+	}
+	return parts
+}
@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestAstPrinterGolden prints the AST of each testdata/ast/*.lox file and compares it to the
+// corresponding .golden file.
+func TestAstPrinterGolden(t *testing.T) {
+	sources, err := filepath.Glob("testdata/ast/*.lox")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range sources {
+		code, err := ioutil.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden, err := ioutil.ReadFile(strings.TrimSuffix(source, ".lox") + ".golden")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reporter := StateErrorReporter{}
+		frontend := NewFrontend(code, &reporter)
+		statements := frontend.Parse()
+		if reporter.HadError {
+			t.Errorf("%s: unexpected parse error", source)
+			continue
+		}
+
+		if printed := (AstPrinter{}).Print(statements); printed != strings.TrimSpace(string(golden)) {
+			t.Errorf("%s: expected\n%s\ngot\n%s", source, golden, printed)
+		}
+	}
+}
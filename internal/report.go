@@ -1,41 +1,267 @@
 package internal
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 )
 
 // ErrorReporter provides a simple error reporting service that can be shared between
 // different parts of the compiler.
 type ErrorReporter interface {
-	Error(line int, message string)
-	Report(line int, where string, message string)
+	Error(line int, column int, message string)
+	Report(line int, column int, where string, message string)
 	RuntimeError(e RuntimeError)
+	// Warn reports a possible mistake that does not stop the code from running.
+	Warn(line int, message string)
 }
 
 // StateErrorReporter is an implementation of ErrorReporter that tracks whether an
-// error was reported and prints errors to standard error.
+// error was reported and prints errors to standard error. If the source code is known,
+// the offending line is printed with a caret under the column of the error.
 type StateErrorReporter struct {
-	HadError        bool // Whether an error has been reported.
-	HadRuntimeError bool // Whether a runtime error has been thrown.
-}
+	HadError          bool // Whether an error has been reported.
+	HadRuntimeError   bool // Whether a runtime error has been thrown.
+	ErrorCount        int  // The number of errors reported, including runtime errors.
+	RuntimeErrorCount int  // The number of runtime errors thrown.
+	Color             bool // Whether errors are highlighted with ANSI escape codes.
+	// The tab width the columns were counted with, see Scanner.TabWidth. If it is more than
+	// 1, tabs in the printed source line are expanded to spaces so the caret lines up.
+	TabWidth int
 
-func (reporter *StateErrorReporter) Error(line int, message string) {
-	reporter.Report(line, "", message)
+	source []byte    // The source code the errors are reported for, if known.
+	out    io.Writer // Where errors are printed to. Standard error is used if nil.
 }
 
-func (reporter *StateErrorReporter) Report(line int, where string, message string) {
-	_, err := fmt.Fprintf(os.Stderr, "[line %d] Error%s: %s\n", line, where, message)
-	if err != nil { // Not sure how else to handle this error for now.
-		panic(err)
+// NewStateErrorReporter creates a reporter that prints to standard error. Colors are
+// enabled if standard error is a terminal.
+func NewStateErrorReporter(source []byte) *StateErrorReporter {
+	return &StateErrorReporter{
+		Color:  IsTerminal(os.Stderr),
+		source: source,
+		out:    os.Stderr,
 	}
+}
+
+// IsTerminal reports whether the file is a terminal rather than e.g. a regular file or pipe.
+func IsTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// SetSource changes the source code that subsequent errors are reported for.
+func (reporter *StateErrorReporter) SetSource(source []byte) {
+	reporter.source = source
+}
+
+// Reset forgets about previously reported errors.
+func (reporter *StateErrorReporter) Reset() {
+	reporter.HadError = false
+	reporter.HadRuntimeError = false
+	reporter.ErrorCount = 0
+	reporter.RuntimeErrorCount = 0
+}
+
+func (reporter *StateErrorReporter) Error(line int, column int, message string) {
+	reporter.Report(line, column, "", message)
+}
+
+func (reporter *StateErrorReporter) Report(line int, column int, where string, message string) {
+	location := reporter.bold(fmt.Sprintf("[line %d, col %d]", line, column))
+	reporter.print(fmt.Sprintf("%s %s: %s\n", location, reporter.red("Error"+where), message), line, column)
 	reporter.HadError = true
+	reporter.ErrorCount++
 }
 
 func (reporter *StateErrorReporter) RuntimeError(e RuntimeError) {
-	_, err := fmt.Fprintf(os.Stderr, "%s\n[line %d]\n", e, e.Token.Line)
+	location := reporter.bold(fmt.Sprintf("[line %d, col %d]", e.Token.Line, e.Token.Column))
+	reporter.print(fmt.Sprintf("%s\n%s\n", reporter.red(e.Error()), location), e.Token.Line, e.Token.Column)
+	reporter.HadRuntimeError = true
+	reporter.ErrorCount++
+	reporter.RuntimeErrorCount++
+}
+
+// Warn prints the warning. Warnings are not counted as errors.
+func (reporter *StateErrorReporter) Warn(line int, message string) {
+	location := reporter.bold(fmt.Sprintf("[line %d]", line))
+	reporter.print(fmt.Sprintf("%s %s: %s\n", location, reporter.yellow("Warning"), message), line, 0)
+}
+
+// print prints the error message followed by the source line and caret, if available.
+func (reporter *StateErrorReporter) print(message string, line int, column int) {
+	out := reporter.out
+	if out == nil {
+		out = os.Stderr
+	}
+
+	_, err := io.WriteString(out, message+reporter.pointAt(line, column))
 	if err != nil { // Not sure how else to handle this error for now.
 		panic(err)
 	}
-	reporter.HadRuntimeError = true
+}
+
+// ANSI escape codes used to highlight errors.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+)
+
+func (reporter *StateErrorReporter) bold(s string) string {
+	if !reporter.Color {
+		return s
+	}
+	return ansiBold + s + ansiReset
+}
+
+func (reporter *StateErrorReporter) red(s string) string {
+	if !reporter.Color {
+		return s
+	}
+	return ansiRed + s + ansiReset
+}
+
+func (reporter *StateErrorReporter) yellow(s string) string {
+	if !reporter.Color {
+		return s
+	}
+	return ansiYellow + s + ansiReset
+}
+
+// pointAt returns the source line followed by a line with a caret under the column, or
+// an empty string if the line is not part of the source.
+func (reporter *StateErrorReporter) pointAt(line int, column int) string {
+	lines := bytes.Split(reporter.source, []byte("\n"))
+	if reporter.source == nil || line < 1 || line > len(lines) || column < 1 {
+		return ""
+	}
+
+	sourceLine := strings.TrimRight(string(lines[line-1]), "\r")
+	if reporter.TabWidth > 1 {
+		sourceLine = expandTabs(sourceLine, reporter.TabWidth)
+	}
+	caret := strings.Builder{}
+	for i, c := range []rune(sourceLine) {
+		if i >= column-1 {
+			break
+		}
+		// Keep tabs so the caret lines up with the source line.
+		if c == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	// The column may be past the end of the line, e.g. at the end of the input.
+	for i := len([]rune(sourceLine)); i < column-1; i++ {
+		caret.WriteRune(' ')
+	}
+	caret.WriteRune('^')
+	return sourceLine + "\n" + caret.String() + "\n"
+}
+
+// expandTabs replaces the tabs in the line with spaces up to the next tab stop, the same
+// way the scanner counts columns.
+func expandTabs(line string, tabWidth int) string {
+	expanded := strings.Builder{}
+	column := 1
+	for _, c := range line {
+		if c == '\t' {
+			next := column + tabWidth - (column-1)%tabWidth
+			expanded.WriteString(strings.Repeat(" ", next-column))
+			column = next
+		} else {
+			expanded.WriteRune(c)
+			column++
+		}
+	}
+	return expanded.String()
+}
+
+// ErrorKind is the phase of the interpreter in which an error was found.
+type ErrorKind int
+
+const (
+	ErrorKindLexical ErrorKind = iota // Reported by the scanner
+	ErrorKindSyntax                   // Reported by the parser
+	ErrorKindRuntime                  // Raised while interpreting
+)
+
+// ReportedError is an error collected by CollectingErrorReporter.
+type ReportedError struct {
+	Kind    ErrorKind
+	Line    int
+	Column  int
+	Where   string // Where the error occurred, e.g. " at 'x'", or empty if not known
+	Message string
+}
+
+func (e ReportedError) Error() string {
+	if e.Kind == ErrorKindRuntime {
+		return fmt.Sprintf("%s\n[line %d, col %d]", e.Message, e.Line, e.Column)
+	}
+	return fmt.Sprintf("[line %d, col %d] Error%s: %s", e.Line, e.Column, e.Where, e.Message)
+}
+
+// CollectingErrorReporter is an implementation of ErrorReporter that keeps the reported
+// errors, so that they can be inspected by the program embedding glox, instead of
+// printing them.
+type CollectingErrorReporter struct {
+	errors   []ReportedError
+	warnings []string
+}
+
+// Errors returns the errors in the order they were reported.
+func (reporter *CollectingErrorReporter) Errors() []ReportedError {
+	return reporter.errors
+}
+
+// Warnings returns the warnings, prefixed with their line, in the order they were reported.
+func (reporter *CollectingErrorReporter) Warnings() []string {
+	return reporter.warnings
+}
+
+func (reporter *CollectingErrorReporter) Error(line int, column int, message string) {
+	reporter.errors = append(reporter.errors, ReportedError{
+		Kind:    ErrorKindLexical,
+		Line:    line,
+		Column:  column,
+		Message: message,
+	})
+}
+
+func (reporter *CollectingErrorReporter) Report(line int, column int, where string, message string) {
+	reporter.errors = append(reporter.errors, ReportedError{
+		Kind:    ErrorKindSyntax,
+		Line:    line,
+		Column:  column,
+		Where:   where,
+		Message: message,
+	})
+}
+
+func (reporter *CollectingErrorReporter) RuntimeError(e RuntimeError) {
+	reporter.errors = append(reporter.errors, ReportedError{
+		Kind:    ErrorKindRuntime,
+		Line:    e.Token.Line,
+		Column:  e.Token.Column,
+		Message: e.Msg,
+	})
+}
+
+func (reporter *CollectingErrorReporter) Warn(line int, message string) {
+	reporter.warnings = append(reporter.warnings, fmt.Sprintf("[line %d] %s", line, message))
+}
+
+// combined combines all collected errors into a single error.
+func (reporter *CollectingErrorReporter) combined() error {
+	messages := make([]string, len(reporter.errors))
+	for i, e := range reporter.errors {
+		messages[i] = e.Error()
+	}
+	return errors.New(strings.Join(messages, "\n"))
 }
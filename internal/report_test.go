@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReportPointsAtColumn(t *testing.T) {
+	source := []byte("var a = 1;\nprint a +;\n")
+	out := bytes.Buffer{}
+	reporter := NewStateErrorReporter(source)
+	reporter.out = &out
+
+	frontend := NewFrontend(source, reporter)
+	frontend.Parse()
+
+	expected := "[line 2, col 10] Error at ';': Expect expression.\n" +
+		"print a +;\n" +
+		"         ^\n"
+	if printed := out.String(); printed != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, printed)
+	}
+}
+
+func TestReportKeepsTabsBeforeCaret(t *testing.T) {
+	out := bytes.Buffer{}
+	reporter := NewStateErrorReporter([]byte("\t\tx @"))
+	reporter.out = &out
+	reporter.Error(1, 5, "Unexpected character.")
+
+	expected := "[line 1, col 5] Error: Unexpected character.\n" +
+		"\t\tx @\n" +
+		"\t\t  ^\n"
+	if printed := out.String(); printed != expected {
+		t.Errorf("expected %q, got %q", expected, printed)
+	}
+}
+
+func TestReportExpandsTabsWithTabWidth(t *testing.T) {
+	source := []byte("\tx @")
+	out := bytes.Buffer{}
+	reporter := NewStateErrorReporter(source)
+	reporter.out = &out
+	reporter.TabWidth = 4
+
+	scanner := NewScanner(source, reporter)
+	scanner.TabWidth = 4
+	scanner.ScanTokens()
+
+	expected := "[line 1, col 7] Error: Unexpected character '@' (U+0040).\n" +
+		"    x @\n" +
+		"      ^\n"
+	if printed := out.String(); printed != expected {
+		t.Errorf("expected %q, got %q", expected, printed)
+	}
+}
+
+func TestCollectingErrorReporter(t *testing.T) {
+	reporter := CollectingErrorReporter{}
+	reporter.Error(1, 2, "Unexpected character.")
+	reporter.Report(3, 4, " at ';'", "Expect expression.")
+	reporter.RuntimeError(RuntimeError{
+		Token: Token{Type: TokenMinus, Lexeme: "-", Line: 5, Column: 6},
+		Msg:   "operand must be a number.",
+	})
+
+	expected := []ReportedError{
+		{Kind: ErrorKindLexical, Line: 1, Column: 2, Message: "Unexpected character."},
+		{Kind: ErrorKindSyntax, Line: 3, Column: 4, Where: " at ';'", Message: "Expect expression."},
+		{Kind: ErrorKindRuntime, Line: 5, Column: 6, Message: "operand must be a number."},
+	}
+	errors := reporter.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %d", len(expected), len(errors))
+	}
+	for i := range expected {
+		if errors[i] != expected[i] {
+			t.Errorf("expected %#v, got %#v", expected[i], errors[i])
+		}
+	}
+}
+
+func TestCollectingErrorReporterFromFrontend(t *testing.T) {
+	reporter := CollectingErrorReporter{}
+	frontend := NewFrontend([]byte("print @;\nvar;"), &reporter)
+	frontend.Parse()
+
+	errors := reporter.Errors()
+	if len(errors) != 3 {
+		t.Fatalf("expected 3 errors, got %v", errors)
+	}
+	if errors[0].Kind != ErrorKindLexical || errors[0].Line != 1 {
+		t.Errorf("expected a lexical error on line 1, got %#v", errors[0])
+	}
+	if errors[1].Kind != ErrorKindSyntax || errors[1].Line != 1 {
+		t.Errorf("expected a syntax error on line 1, got %#v", errors[1])
+	}
+	if errors[2].Kind != ErrorKindSyntax || errors[2].Line != 2 {
+		t.Errorf("expected a syntax error on line 2, got %#v", errors[2])
+	}
+}
+
+func TestReportColor(t *testing.T) {
+	out := bytes.Buffer{}
+	reporter := StateErrorReporter{Color: true, out: &out}
+	reporter.Report(1, 2, " at 'x'", "Expect expression.")
+
+	expected := "\x1b[1m[line 1, col 2]\x1b[0m \x1b[31mError at 'x'\x1b[0m: Expect expression.\n"
+	if printed := out.String(); printed != expected {
+		t.Errorf("expected %q, got %q", expected, printed)
+	}
+
+	out.Reset()
+	reporter.Color = false
+	reporter.Report(1, 2, " at 'x'", "Expect expression.")
+	if printed := out.String(); printed != "[line 1, col 2] Error at 'x': Expect expression.\n" {
+		t.Errorf("expected no escape codes without color, got %q", printed)
+	}
+}
+
+func TestWarningIsNotAnError(t *testing.T) {
+	out := bytes.Buffer{}
+	reporter := NewStateErrorReporter([]byte("return;\nprint 1;"))
+	reporter.out = &out
+	reporter.Warn(1, "Unreachable code after 'return'.")
+
+	if reporter.HadError || reporter.ErrorCount != 0 {
+		t.Error("expected a warning not to count as an error")
+	}
+	if printed, expected := out.String(), "[line 1] Warning: Unreachable code after 'return'.\n"; printed != expected {
+		t.Errorf("expected %q, got %q", expected, printed)
+	}
+}
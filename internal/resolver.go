@@ -0,0 +1,429 @@
+package internal
+
+import (
+	"errors"
+	"sort"
+)
+
+// Resolver is a static pass over the AST, run before interpretation, that resolves each
+// variable to the scope it is declared in. The number of scopes between the use and the
+// declaration is stored in the Resolution of the use, so that a variable always refers to
+// the same declaration, e.g. a closure keeps referring to the variable it captured even if
+// a variable with the same name is declared later on.
+type Resolver struct {
+	interpreter *Interpreter
+	reporter    ErrorReporter
+	hadError    bool
+	// The local scopes enclosing the current node, innermost last. Each scope maps the
+	// name of a variable to whether its initializer has been resolved.
+	scopes []map[string]bool
+	// The global variables declared so far
+	globals map[string]bool
+	// The local variables, by scope, that have been declared with var but not read yet
+	unused []map[string]Token
+
+	// WarnUnused enables warnings for local variables that are never read.
+	WarnUnused bool
+}
+
+// Resolution is how the Resolver resolved a use of a variable. The parser gives each use
+// its own, which copies of the node share, so that uses at the same position in separate
+// code, e.g. lines of the REPL, are resolved separately.
+type Resolution struct {
+	isLocal bool
+	depth   int // The number of environments between the use and the declaration
+}
+
+func NewResolver(interpreter *Interpreter, reporter ErrorReporter) Resolver {
+	return Resolver{
+		interpreter: interpreter,
+		reporter:    reporter,
+		globals:     make(map[string]bool),
+	}
+}
+
+// Resolve resolves the variables of the statements. All errors are reported, in which case
+// an error is returned.
+func (resolver *Resolver) Resolve(statements []Stmt) error {
+	resolver.resolveStmts(statements)
+	if resolver.hadError {
+		return errors.New("failed to resolve")
+	}
+	return nil
+}
+
+// ResolveExpression resolves the variables of a single expression, e.g. one entered in
+// the REPL.
+func (resolver *Resolver) ResolveExpression(expr Expr) error {
+	resolver.resolveExpr(expr)
+	if resolver.hadError {
+		return errors.New("failed to resolve")
+	}
+	return nil
+}
+
+func (resolver *Resolver) error(token Token, msg string) {
+	resolver.hadError = true
+	resolver.reporter.Report(token.Line, token.Column, " at '"+token.Lexeme+"'", msg)
+}
+
+// resolveStmts resolves the statements of a block or function body. A warning is reported
+// for statements following a return, break or continue, as they are never executed.
+func (resolver *Resolver) resolveStmts(statements []Stmt) {
+	unreachable := false
+	for i, stmt := range statements {
+		resolver.resolveStmt(stmt)
+		// Only the first jump makes the code after it unreachable.
+		if keyword, jumps := jump(stmt); jumps && !unreachable && i < len(statements)-1 {
+			resolver.reporter.Warn(keyword.Line, "Unreachable code after '"+keyword.Lexeme+"'.")
+			unreachable = true
+		}
+	}
+}
+
+// jump returns the keyword of a statement that jumps out of the current block.
+func jump(stmt Stmt) (Token, bool) {
+	switch s := stmt.(type) {
+	case Return:
+		return s.Keyword, true
+	case Break:
+		return s.Keyword, true
+	case Continue:
+		return s.Keyword, true
+	}
+	return Token{}, false
+}
+
+func (resolver *Resolver) resolveStmt(stmt Stmt) {
+	if stmt != nil {
+		stmt.Visit(resolver)
+	}
+}
+
+func (resolver *Resolver) resolveExpr(expr Expr) {
+	if expr != nil {
+		expr.Visit(resolver)
+	}
+}
+
+func (resolver *Resolver) beginScope() {
+	resolver.scopes = append(resolver.scopes, make(map[string]bool))
+	resolver.unused = append(resolver.unused, make(map[string]Token))
+}
+
+func (resolver *Resolver) endScope() {
+	if resolver.WarnUnused {
+		var unused []Token
+		for _, name := range resolver.unused[len(resolver.unused)-1] {
+			unused = append(unused, name)
+		}
+		// Warn in the order the variables were declared.
+		sort.Slice(unused, func(i, j int) bool {
+			return unused[i].StartOffset < unused[j].StartOffset
+		})
+		for _, name := range unused {
+			resolver.reporter.Warn(name.Line, "Local variable '"+name.Lexeme+"' is never used.")
+		}
+	}
+	resolver.scopes = resolver.scopes[:len(resolver.scopes)-1]
+	resolver.unused = resolver.unused[:len(resolver.unused)-1]
+}
+
+// declare adds the variable to the innermost scope, marking it as not yet initialized.
+func (resolver *Resolver) declare(name Token) {
+	if len(resolver.scopes) == 0 {
+		return
+	}
+	resolver.scopes[len(resolver.scopes)-1][name.Lexeme] = false
+}
+
+// define marks the variable in the innermost scope as initialized.
+func (resolver *Resolver) define(name Token) {
+	if len(resolver.scopes) == 0 {
+		resolver.globals[name.Lexeme] = true
+		return
+	}
+	resolver.scopes[len(resolver.scopes)-1][name.Lexeme] = true
+}
+
+// resolveLocal finds the innermost scope the variable is declared in, and returns its index.
+// Variables that are not declared in any local scope are assumed to be global, for which
+// -1 is returned. The result is recorded in the resolution of the use.
+func (resolver *Resolver) resolveLocal(name Token, resolution *Resolution) int {
+	return resolver.resolveFrom(name, resolution, len(resolver.scopes)-1)
+}
+
+// resolveFrom is like resolveLocal, but ignores the scopes inside the given one.
+func (resolver *Resolver) resolveFrom(name Token, resolution *Resolution, innermost int) int {
+	for i := innermost; i >= 0; i-- {
+		if _, found := resolver.scopes[i][name.Lexeme]; found {
+			*resolution = Resolution{isLocal: true, depth: len(resolver.scopes) - 1 - i}
+			return i
+		}
+	}
+	*resolution = Resolution{}
+	return -1
+}
+
+func (resolver *Resolver) resolveFunction(function Function) {
+	resolver.beginScope()
+	for _, param := range function.Params {
+		resolver.declare(param)
+		resolver.define(param)
+	}
+	resolver.resolveStmts(function.Body)
+	resolver.endScope()
+}
+
+func (resolver *Resolver) VisitBlock(block Block) (error, interface{}) {
+	resolver.beginScope()
+	resolver.resolveStmts(block.Statements)
+	resolver.endScope()
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitClass(stmt Class) (error, interface{}) {
+	resolver.declare(stmt.Name)
+	resolver.define(stmt.Name)
+
+	// The scopes match the environments the interpreter creates for the methods: one in
+	// which `super` is defined, and one in which `this` is bound to the instance.
+	if stmt.Superclass != nil {
+		resolver.resolveExpr(stmt.Superclass)
+		resolver.beginScope()
+		resolver.scopes[len(resolver.scopes)-1]["super"] = true
+	}
+	resolver.beginScope()
+	resolver.scopes[len(resolver.scopes)-1]["this"] = true
+
+	for _, method := range stmt.Methods {
+		resolver.resolveFunction(method)
+	}
+
+	resolver.endScope()
+	if stmt.Superclass != nil {
+		resolver.endScope()
+	}
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitVar(stmt Var) (error, interface{}) {
+	resolver.declare(stmt.Name)
+	if len(resolver.unused) > 0 {
+		resolver.unused[len(resolver.unused)-1][stmt.Name.Lexeme] = stmt.Name
+	}
+	resolver.resolveExpr(stmt.Initializer)
+	resolver.define(stmt.Name)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitFunction(stmt Function) (error, interface{}) {
+	// The name is defined before the body is resolved so that the function can recurse.
+	resolver.declare(stmt.Name)
+	resolver.define(stmt.Name)
+	resolver.resolveFunction(stmt)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitExpression(stmt Expression) (error, interface{}) {
+	resolver.resolveExpr(stmt.Expression)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitPrint(stmt Print) (error, interface{}) {
+	for _, expr := range stmt.Expressions {
+		resolver.resolveExpr(expr)
+	}
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitIf(stmt If) (error, interface{}) {
+	resolver.resolveExpr(stmt.Condition)
+	resolver.resolveStmt(stmt.ThenBranch)
+	resolver.resolveStmt(stmt.ElseBranch)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitWhile(stmt While) (error, interface{}) {
+	resolver.resolveExpr(stmt.Condition)
+	resolver.resolveStmt(stmt.Body)
+	resolver.resolveExpr(stmt.Increment)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitDoWhile(stmt DoWhile) (error, interface{}) {
+	resolver.resolveStmt(stmt.Body)
+	resolver.resolveExpr(stmt.Condition)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitSwitch(stmt Switch) (error, interface{}) {
+	resolver.resolveExpr(stmt.Subject)
+	for i, value := range stmt.Cases {
+		resolver.resolveExpr(value)
+		resolver.resolveStmt(stmt.Bodies[i])
+	}
+	resolver.resolveStmt(stmt.Default)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitReturn(stmt Return) (error, interface{}) {
+	resolver.resolveExpr(stmt.Value)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitBreak(stmt Break) (error, interface{}) {
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitContinue(stmt Continue) (error, interface{}) {
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitVariable(variable Variable) (error, interface{}) {
+	innermost := len(resolver.scopes) - 1
+	if innermost >= 0 {
+		if defined, declared := resolver.scopes[innermost][variable.Name.Lexeme]; declared && !defined {
+			// The variable is read in its own initializer. This is only allowed if it
+			// shadows another variable, which is the one that is read.
+			if !resolver.isDeclaredOutside(variable.Name, innermost) {
+				resolver.error(variable.Name, "Can't read local variable in its own initializer.")
+			}
+			resolver.read(variable.Name, resolver.resolveFrom(variable.Name, variable.Resolution, innermost-1))
+			return nil, nil
+		}
+	}
+	resolver.read(variable.Name, resolver.resolveLocal(variable.Name, variable.Resolution))
+	return nil, nil
+}
+
+// read marks the variable declared in the scope as used.
+func (resolver *Resolver) read(name Token, scope int) {
+	if scope >= 0 {
+		delete(resolver.unused[scope], name.Lexeme)
+	}
+}
+
+// isDeclaredOutside returns whether the variable is declared outside the given scope, either
+// in an enclosing scope or as a global variable.
+func (resolver *Resolver) isDeclaredOutside(name Token, scope int) bool {
+	for i := scope - 1; i >= 0; i-- {
+		if _, found := resolver.scopes[i][name.Lexeme]; found {
+			return true
+		}
+	}
+	if resolver.globals[name.Lexeme] {
+		return true
+	}
+	// Globals defined by earlier runs of the interpreter, e.g. in the REPL, or natives.
+	_, found := resolver.interpreter.globals.values[name.Lexeme]
+	return found
+}
+
+func (resolver *Resolver) VisitAssign(assign Assign) (error, interface{}) {
+	resolver.resolveExpr(assign.Value)
+	resolver.resolveLocal(assign.Name, assign.Resolution)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitThis(this This) (error, interface{}) {
+	resolver.resolveLocal(this.Keyword, this.Resolution)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitSuper(super Super) (error, interface{}) {
+	resolver.resolveLocal(super.Keyword, super.Resolution)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitLambda(lambda Lambda) (error, interface{}) {
+	resolver.resolveFunction(lambda.Declaration)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitInterpolation(interpolation Interpolation) (error, interface{}) {
+	for _, part := range interpolation.Parts {
+		resolver.resolveExpr(part)
+	}
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitBinary(binary Binary) (error, interface{}) {
+	resolver.resolveExpr(binary.Left)
+	resolver.resolveExpr(binary.Right)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitLogical(logical Logical) (error, interface{}) {
+	resolver.resolveExpr(logical.Left)
+	resolver.resolveExpr(logical.Right)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitGrouping(grouping Grouping) (error, interface{}) {
+	resolver.resolveExpr(grouping.Expression)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitLiteral(literal Literal) (error, interface{}) {
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitUnary(unary Unary) (error, interface{}) {
+	resolver.resolveExpr(unary.Right)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitTernary(ternary Ternary) (error, interface{}) {
+	resolver.resolveExpr(ternary.Cond)
+	resolver.resolveExpr(ternary.TrueBranch)
+	resolver.resolveExpr(ternary.FalseBranch)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitCall(call Call) (error, interface{}) {
+	resolver.resolveExpr(call.Callee)
+	for _, argument := range call.Arguments {
+		resolver.resolveExpr(argument)
+	}
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitList(list List) (error, interface{}) {
+	for _, element := range list.Elements {
+		resolver.resolveExpr(element)
+	}
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitMap(m Map) (error, interface{}) {
+	for i := range m.Keys {
+		resolver.resolveExpr(m.Keys[i])
+		resolver.resolveExpr(m.Values[i])
+	}
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitIndex(index Index) (error, interface{}) {
+	resolver.resolveExpr(index.Object)
+	resolver.resolveExpr(index.Index)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitSetIndex(index SetIndex) (error, interface{}) {
+	resolver.resolveExpr(index.Object)
+	resolver.resolveExpr(index.Index)
+	resolver.resolveExpr(index.Value)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitGet(get Get) (error, interface{}) {
+	resolver.resolveExpr(get.Object)
+	return nil, nil
+}
+
+func (resolver *Resolver) VisitSet(set Set) (error, interface{}) {
+	resolver.resolveExpr(set.Value)
+	resolver.resolveExpr(set.Object)
+	return nil, nil
+}
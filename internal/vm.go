@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// VM runs bytecode compiled by Compile on a stack of values. It is an alternative to the
+// tree-walking Interpreter, which avoids the cost of visiting the AST in tight code.
+type VM struct {
+	reporter ErrorReporter
+	// Runs the operations that the VM doesn't specialize, so that both backends give the
+	// same results, and provides the output writer.
+	interpreter Interpreter
+	stack       []interface{}
+}
+
+// NewVM creates a VM that prints to out. If out is nil then the VM prints to standard output.
+func NewVM(reporter ErrorReporter, out io.Writer) VM {
+	return VM{
+		reporter:    reporter,
+		interpreter: NewInterpreter(reporter, out),
+		stack:       make([]interface{}, 0, 256),
+	}
+}
+
+// SetDecimals sets the number of decimals of printed floating point numbers, see
+// Interpreter.Decimals.
+func (vm *VM) SetDecimals(decimals int) {
+	vm.interpreter.Decimals = decimals
+}
+
+// Run runs the chunk. Execution stops at the first runtime error, which is reported to the
+// error reporter.
+func (vm *VM) Run(chunk *Chunk) {
+	if e := vm.run(chunk); e != nil {
+		switch err := e.(type) {
+		case RuntimeError:
+			vm.reporter.RuntimeError(err)
+		default:
+			panic(err)
+		}
+	}
+	vm.stack = vm.stack[:0]
+}
+
+func (vm *VM) run(chunk *Chunk) error {
+	for ip := 0; ; {
+		op := OpCode(chunk.Code[ip])
+		token := chunk.Tokens[ip]
+		ip++
+
+		switch op {
+		case OpConstant:
+			vm.push(chunk.Constants[chunk.readUint16(ip)])
+			ip += 2
+		case OpNil:
+			vm.push(nil)
+		case OpTrue:
+			vm.push(true)
+		case OpFalse:
+			vm.push(false)
+		case OpPop:
+			vm.pop()
+		case OpNot:
+			vm.push(!vm.interpreter.isTruthy(vm.pop()))
+		case OpNegate:
+			right := vm.pop()
+			switch v := right.(type) {
+			case int64:
+				if v == math.MinInt64 {
+					vm.push(-float64(v))
+				} else {
+					vm.push(-v)
+				}
+			case float64:
+				vm.push(-v)
+			default:
+				e, result := vm.interpreter.unary(token, right)
+				if e != nil {
+					return e
+				}
+				vm.push(result)
+			}
+		case OpPrint:
+			count := int(chunk.Code[ip])
+			ip++
+			values := make([]string, count)
+			for i := count - 1; i >= 0; i-- {
+				values[i] = vm.interpreter.stringify(vm.pop())
+			}
+			if _, e := fmt.Fprintln(vm.interpreter.out, strings.Join(values, " ")); e != nil {
+				return e
+			}
+		case OpReturn:
+			return nil
+		default:
+			right := vm.pop()
+			left := vm.pop()
+			// Arithmetic and comparison of two numbers of the same type is done directly.
+			if result, isDone := arithmetic(op, left, right); isDone {
+				vm.push(result)
+				continue
+			}
+			e, result := vm.interpreter.binary(token, left, right)
+			if e != nil {
+				return e
+			}
+			vm.push(result)
+		}
+	}
+}
+
+// arithmetic applies the operator of the instruction if both operands are integers or both
+// are floating point numbers. It reports whether it did.
+func arithmetic(op OpCode, left interface{}, right interface{}) (interface{}, bool) {
+	switch leftV := left.(type) {
+	case int64:
+		rightV, isInteger := right.(int64)
+		if !isInteger {
+			return nil, false
+		}
+		// Overflowing arithmetic is left to the interpreter, which does it in floating point.
+		switch op {
+		case OpAdd:
+			return leftV + rightV, !additionOverflows(leftV, rightV)
+		case OpSubtract:
+			return leftV - rightV, !subtractionOverflows(leftV, rightV)
+		case OpMultiply:
+			return leftV * rightV, !multiplicationOverflows(leftV, rightV)
+		case OpLess:
+			return leftV < rightV, true
+		case OpLessEqual:
+			return leftV <= rightV, true
+		case OpGreater:
+			return leftV > rightV, true
+		case OpGreaterEqual:
+			return leftV >= rightV, true
+		case OpEqual:
+			return leftV == rightV, true
+		case OpNotEqual:
+			return leftV != rightV, true
+		}
+	case float64:
+		rightV, isFloat := right.(float64)
+		if !isFloat {
+			return nil, false
+		}
+		switch op {
+		case OpAdd:
+			return leftV + rightV, true
+		case OpSubtract:
+			return leftV - rightV, true
+		case OpMultiply:
+			return leftV * rightV, true
+		case OpLess:
+			return leftV < rightV, true
+		case OpLessEqual:
+			return leftV <= rightV, true
+		case OpGreater:
+			return leftV > rightV, true
+		case OpGreaterEqual:
+			return leftV >= rightV, true
+		case OpEqual:
+			return leftV == rightV, true
+		case OpNotEqual:
+			return leftV != rightV, true
+		}
+	}
+	// Everything else, e.g. division, which checks for a zero divisor.
+	return nil, false
+}
+
+func (vm *VM) push(value interface{}) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *VM) pop() interface{} {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
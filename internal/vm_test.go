@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// compile parses and compiles the source code, failing the test on errors.
+func compile(t testing.TB, source string) *Chunk {
+	reporter := CollectingErrorReporter{}
+	frontend := NewFrontend([]byte(source), &reporter)
+	statements := frontend.Parse()
+	if errors := reporter.Errors(); len(errors) > 0 {
+		t.Fatalf("unexpected errors parsing %s: %v", source, errors)
+	}
+	chunk, e := Compile(statements, &reporter)
+	if e != nil {
+		t.Fatalf("unexpected error compiling %s: %v", source, e)
+	}
+	return chunk
+}
+
+func TestVMMatchesInterpreter(t *testing.T) {
+	for _, source := range []string{
+		"print 1 + 2 * 3 - 4;",
+		"print 7 / 2;",
+		"print (1 + 2.5) * -2;",
+		`print "a" + "b";`,
+		`print "ab" * 2;`,
+		"print 1 < 2 == !false;",
+		"print 1 == 1.0;",
+		"print 2.5 >= 2;",
+		"print nil == false;",
+		"print !nil;",
+		"print --3;",
+		"1 + 2; print 3;",
+		`print 1, "x", 2 > 1;`,
+		"print 9223372036854775807 + 1;",
+		"print -9223372036854775807 - 2;",
+		"print 4611686018427387904 * 2;",
+		"print -(-9223372036854775807 - 1);",
+		"print 1; { print 2; { print 3; } }",
+	} {
+		out := bytes.Buffer{}
+		vm := NewVM(&CollectingErrorReporter{}, &out)
+		vm.Run(compile(t, source))
+
+		expected := bytes.Buffer{}
+		interpreter := NewInterpreter(&CollectingErrorReporter{}, &expected)
+		frontend := NewFrontend([]byte(source), &CollectingErrorReporter{})
+		interpreter.Execute(frontend.Parse())
+
+		if out.String() != expected.String() {
+			t.Errorf("expected %s to print %q, got %q", source, expected.String(), out.String())
+		}
+	}
+}
+
+func TestVMRuntimeError(t *testing.T) {
+	reporter := CollectingErrorReporter{}
+	out := bytes.Buffer{}
+	vm := NewVM(&reporter, &out)
+	vm.Run(compile(t, "print 1;\nprint 2 / 0;\nprint 3;"))
+
+	if printed := out.String(); printed != "1\n" {
+		t.Errorf("expected execution to stop at the error, got %q", printed)
+	}
+	errors := reporter.Errors()
+	if len(errors) != 1 || errors[0].Message != "Division by zero." || errors[0].Line != 2 || errors[0].Column != 9 {
+		t.Errorf("unexpected errors %v", errors)
+	}
+}
+
+func TestCompileUnsupported(t *testing.T) {
+	tests := map[string]ReportedError{
+		"var a = 1;":                    {Line: 1, Column: 5, Message: "The VM doesn't support variables yet."},
+		"print 1 and 2;":                {Line: 1, Column: 9, Message: "The VM doesn't support the and operator yet."},
+		"print 1;\nprint 1 + len(1);":   {Line: 2, Column: 16, Message: "The VM doesn't support calls yet."},
+		"{\n  while (true) print 1;\n}": {Line: 2, Column: 3, Message: "The VM doesn't support loops yet."},
+	}
+	for source, expected := range tests {
+		reporter := CollectingErrorReporter{}
+		frontend := NewFrontend([]byte(source), &reporter)
+		if _, e := Compile(frontend.Parse(), &reporter); e == nil {
+			t.Errorf("expected an error compiling %s", source)
+		}
+		if errors := reporter.Errors(); len(errors) != 1 || errors[0].Line != expected.Line || errors[0].Column != expected.Column || errors[0].Message != expected.Message {
+			t.Errorf("expected error %v compiling %s, got %v", expected, source, errors)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	expected := strings.Join([]string{
+		"0000 CONSTANT 0 '1'",
+		"0003 CONSTANT 1 '2'",
+		"0006 NEGATE",
+		"0007 ADD",
+		"0008 PRINT 1",
+		"0010 TRUE",
+		"0011 POP",
+		"0012 RETURN",
+	}, "\n")
+	if disassembly := compile(t, "print 1 + -2; true;").Disassemble(); disassembly != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, disassembly)
+	}
+}
+
+// benchmarkProgram is arithmetic-heavy code that both backends can run.
+var benchmarkProgram = strings.Repeat("(1 + 2) * 3 - 4 / 5 + 6.5 * 7 < 100 == !(8 - 9 >= 10 * 11);\n", 1000)
+
+func BenchmarkTreeWalk(b *testing.B) {
+	frontend := NewFrontend([]byte(benchmarkProgram), &CollectingErrorReporter{})
+	statements := frontend.Parse()
+	interpreter := NewInterpreter(&CollectingErrorReporter{}, nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		interpreter.Execute(statements)
+	}
+}
+
+func BenchmarkVM(b *testing.B) {
+	chunk := compile(b, benchmarkProgram)
+	vm := NewVM(&CollectingErrorReporter{}, nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vm.Run(chunk)
+	}
+}
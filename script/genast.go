@@ -28,11 +28,36 @@ func main() {
 		"Grouping : Expression Expr",
 		"Literal  : Value fmt.Stringer",
 		"Unary    : Operator Token\nRight Expr",
-		"Ternary  : Cond Expr\nTrueBranch Expr\nFalseBranch Expr",
+		"Ternary  : Cond Expr\nQuestion Token\nTrueBranch Expr\nFalseBranch Expr",
+		"Variable : Name Token\nResolution *Resolution",
+		"Assign   : Name Token\nValue Expr\nResolution *Resolution",
+		"Logical  : Left Expr\nOperator Token\nRight Expr",
+		"Call     : Callee Expr\nParen Token\nArguments []Expr",
+		"List     : Bracket Token\nElements []Expr",
+		"Index    : Object Expr\nBracket Token\nIndex Expr",
+		"SetIndex : Object Expr\nBracket Token\nIndex Expr\nValue Expr",
+		"Map      : Brace Token\nKeys []Expr\nValues []Expr",
+		"Get      : Object Expr\nName Token",
+		"Set      : Object Expr\nName Token\nValue Expr",
+		"This     : Keyword Token\nResolution *Resolution",
+		"Super    : Keyword Token\nMethod Token\nResolution *Resolution",
+		"Lambda   : Declaration Function",
+		"Interpolation : Start Token\nParts []Expr",
 	})
 	defineAst(&output, "Stmt", []string{
-		"Expression : Expr *Expression",
-		"Print		: Expr Expression",
+		"Expression : Expression Expr",
+		"Print      : Expressions []Expr",
+		"Var        : Name Token\nInitializer Expr",
+		"Block      : Statements []Stmt",
+		"If         : Keyword Token\nCondition Expr\nThenBranch Stmt\nElseBranch Stmt",
+		"While      : Keyword Token\nCondition Expr\nBody Stmt\nIncrement Expr",
+		"DoWhile    : Keyword Token\nBody Stmt\nCondition Expr",
+		"Function   : Name Token\nParams []Token\nBody []Stmt",
+		"Return     : Keyword Token\nValue Expr",
+		"Break      : Keyword Token",
+		"Continue   : Keyword Token",
+		"Switch     : Keyword Token\nSubject Expr\nCases []Expr\nBodies []Stmt\nDefault Stmt",
+		"Class      : Name Token\nSuperclass Expr\nMethods []Function",
 	})
 
 	// Format the source code before writing to disk.